@@ -0,0 +1,182 @@
+package patterns
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Allowlist describes matches that must not be reported. A match is allowed
+// as soon as any one of the conditions below applies to it.
+type Allowlist struct {
+	Description string
+	Paths       []*regexp.Regexp // Matched against the file path, compiled from regexes and globs
+	Commits     []string         // Full or abbreviated commit hashes
+	Regexes     []*regexp.Regexp // Matched against the RegexTarget of the match
+	RegexTarget string           // "secret" (default), "match" or "line"
+	StopWords   []string         // Case-insensitive substrings of the secret
+	Contexts    []string         // Markdown contexts of the secret, see matchesContext
+}
+
+// AllowlistConfig defines the structure of an allowlist in the TOML config file
+type AllowlistConfig struct {
+	Description string   `toml:"description"`
+	Paths       []string `toml:"paths"`
+	PathGlobs   []string `toml:"pathGlobs"`
+	Commits     []string `toml:"commits"`
+	Regexes     []string `toml:"regexes"`
+	RegexTarget string   `toml:"regexTarget"`
+	StopWords   []string `toml:"stopwords"`
+	Contexts    []string `toml:"contexts"`
+}
+
+// IsAllowed reports whether the match found in the given commit is covered by the
+// global allowlist or by the allowlist of the pattern that produced it.
+func (rs *Ruleset) IsAllowed(match MatchResult, commit string) bool {
+	if rs.Allowlist.allows(match, commit) {
+		return true
+	}
+	pattern, ok := rs.byID[match.RuleID]
+	return ok && pattern.Allowlist.allows(match, commit)
+}
+
+func (a *Allowlist) allows(match MatchResult, commit string) bool {
+	if a == nil {
+		return false
+	}
+
+	if commit != "" {
+		for _, allowed := range a.Commits {
+			if allowed != "" && strings.HasPrefix(commit, allowed) {
+				return true
+			}
+		}
+	}
+
+	for _, path := range a.Paths {
+		if path.MatchString(match.FileName) {
+			return true
+		}
+	}
+
+	// Like gitleaks, regexes are matched against the secret by default
+	target := match.Secret
+	switch a.RegexTarget {
+	case "match":
+		target = match.MatchString
+	case "line":
+		target = match.Line
+	}
+	for _, regex := range a.Regexes {
+		if regex.MatchString(target) {
+			return true
+		}
+	}
+
+	if match.Context != "" && matchesContext(a.Contexts, match.Context, match.Language) {
+		return true
+	}
+
+	secret := strings.ToLower(match.Secret)
+	for _, stopWord := range a.StopWords {
+		if strings.Contains(secret, strings.ToLower(stopWord)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// compile turns the allowlist of a TOML config file into an Allowlist
+func (c *AllowlistConfig) compile() (*Allowlist, error) {
+	switch c.RegexTarget {
+	case "", "secret", "match", "line":
+	default:
+		return nil, fmt.Errorf("unknown allowlist regexTarget %q", c.RegexTarget)
+	}
+
+	allowlist := &Allowlist{
+		Description: c.Description,
+		Commits:     c.Commits,
+		RegexTarget: c.RegexTarget,
+		StopWords:   c.StopWords,
+		Contexts:    c.Contexts,
+	}
+	if err := parseContexts(c.Contexts); err != nil {
+		return nil, err
+	}
+
+	for _, path := range c.Paths {
+		regex, err := regexp.Compile(path)
+		if err != nil {
+			return nil, err
+		}
+		allowlist.Paths = append(allowlist.Paths, regex)
+	}
+
+	for _, glob := range c.PathGlobs {
+		regex, err := regexp.Compile(globToRegexp(glob))
+		if err != nil {
+			return nil, fmt.Errorf("invalid path glob %q: %w", glob, err)
+		}
+		allowlist.Paths = append(allowlist.Paths, regex)
+	}
+
+	for _, pattern := range c.Regexes {
+		regex, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, err
+		}
+		allowlist.Regexes = append(allowlist.Regexes, regex)
+	}
+
+	return allowlist, nil
+}
+
+// globToRegexp translates a path glob into an anchored regex. "*" and "?" do
+// not cross directories while "**" does, a glob without a slash matches the
+// file name in any directory and a glob ending with a slash matches everything
+// under that directory.
+func globToRegexp(glob string) string {
+	var regex strings.Builder
+	regex.WriteString("^")
+	if !strings.Contains(strings.TrimSuffix(glob, "/"), "/") {
+		regex.WriteString("(?:.*/)?")
+	}
+	glob = strings.TrimPrefix(glob, "/")
+
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; {
+		case strings.HasPrefix(glob[i:], "**/"):
+			regex.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			regex.WriteString(".*")
+			i++
+		case c == '*':
+			regex.WriteString("[^/]*")
+		case c == '?':
+			regex.WriteString("[^/]")
+		case c == '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				regex.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			regex.WriteString("[" + class + "]")
+			i += end
+		default:
+			regex.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	if strings.HasSuffix(glob, "/") {
+		regex.WriteString(".*")
+	}
+	regex.WriteString("$")
+	return regex.String()
+}
@@ -0,0 +1,67 @@
+package patterns
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob  string
+		path  string
+		match bool
+	}{
+		// A glob without a slash matches the file name in any directory
+		{"*.md", "README.md", true},
+		{"*.md", "docs/guide/setup.md", true},
+		{"*.md", "README.mdx", false},
+		{"README.md", "docs/README.md", true},
+		{"README.md", "docs/NOT-README.md", false},
+
+		// A glob with a slash is anchored at the root, "*" stops at slashes
+		{"docs/*.md", "docs/setup.md", true},
+		{"docs/*.md", "docs/guide/setup.md", false},
+		{"docs/*.md", "site/docs/setup.md", false},
+		{"/docs/*.md", "docs/setup.md", true},
+		{"/docs/*.md", "site/docs/setup.md", false},
+
+		// "**" crosses directories, "**/" also matches no directory at all
+		{"docs/**/*.md", "docs/setup.md", true},
+		{"docs/**/*.md", "docs/guide/v1/setup.md", true},
+		{"docs/**/*.md", "site/docs/setup.md", false},
+		{"**/fixtures/*", "test/fixtures/key.pem", true},
+		{"**/fixtures/*", "fixtures/key.pem", true},
+		{"docs/**", "docs/guide/setup.md", true},
+		{"docs/**", "docsite/setup.md", false},
+
+		// A trailing slash matches everything under the directory
+		{"testdata/", "testdata/keys/id_rsa", true},
+		{"testdata/", "pkg/testdata/id_rsa", true},
+		{"testdata/", "testdata.md", false},
+		{"docs/examples/", "docs/examples/a/b.md", true},
+		{"docs/examples/", "site/docs/examples/b.md", false},
+
+		// "?" matches one character but not a slash
+		{"key?.pem", "key1.pem", true},
+		{"key?.pem", "key12.pem", false},
+		{"a?b", "a/b", false},
+
+		// Character classes, negated with "!"
+		{"key[0-9].pem", "key7.pem", true},
+		{"key[0-9].pem", "keyx.pem", false},
+		{"key[!0-9].pem", "keyx.pem", true},
+		{"key[!0-9].pem", "key7.pem", false},
+		{"key[.pem", "key[.pem", true},
+
+		// Regex metacharacters are literal
+		{"a+b.(md)", "a+b.(md)", true},
+		{"a+b.(md)", "aab.md", false},
+	}
+
+	for _, tt := range tests {
+		regex := regexp.MustCompile(globToRegexp(tt.glob))
+		if got := regex.MatchString(tt.path); got != tt.match {
+			t.Errorf("glob %q (regex %q) on %q: matched %v, want %v", tt.glob, regex, tt.path, got, tt.match)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package patterns
+
+import (
+	"math"
+	"unicode/utf8"
+)
+
+// shannonEntropy returns the Shannon entropy of the characters of value, in
+// bits per character. Random keys score high while words, repeated characters
+// and placeholders score low.
+func shannonEntropy(value string) float64 {
+	if value == "" {
+		return 0
+	}
+
+	counts := make(map[rune]int)
+	for _, r := range value {
+		counts[r]++
+	}
+
+	// Sum in the order the characters appear so the result does not depend on
+	// the map iteration order
+	length := float64(utf8.RuneCountInString(value))
+	entropy := 0.0
+	for _, r := range value {
+		if counts[r] == 0 {
+			continue
+		}
+		frequency := float64(counts[r]) / length
+		entropy -= frequency * math.Log2(frequency)
+		counts[r] = 0
+	}
+	return entropy
+}
+
+// submatch returns the text of the capture group of a match, or an empty
+// string when the group did not take part in it
+func submatch(line string, submatches []int, group int) string {
+	if 2*group+1 >= len(submatches) || submatches[2*group] < 0 {
+		return ""
+	}
+	return line[submatches[2*group]:submatches[2*group+1]]
+}
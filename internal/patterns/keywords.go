@@ -0,0 +1,117 @@
+package patterns
+
+import (
+	"strings"
+)
+
+// keywordMatcher is an Aho-Corasick automaton over the keywords of every
+// pattern. A single pass over a line tells which patterns have one of their
+// keywords in it, so the regexes of the other patterns are never run.
+//
+// Keywords are matched ASCII case-insensitively: upper and lower case ASCII
+// letters share the same byte class, which saves lower-casing every line.
+type keywordMatcher struct {
+	classes    [256]uint16 // Byte class of every byte, 0 for bytes in no keyword
+	numClasses int
+	next       []int32 // Transitions, indexed by state*numClasses+class
+	outputs    [][]int // Patterns with a keyword ending at each state
+	always     []int   // Patterns without keywords, evaluated on every line
+}
+
+// newKeywordMatcher builds the automaton for the keywords of the patterns
+func newKeywordMatcher(patterns []DefinePatternInfo) *keywordMatcher {
+	m := &keywordMatcher{numClasses: 1}
+
+	// Build the trie of the lower-cased keywords
+	children := []map[byte]int32{{}}
+	outputs := [][]int{nil}
+	for i, pattern := range patterns {
+		if !hasKeywords(pattern) {
+			m.always = append(m.always, i)
+			continue
+		}
+
+		for _, keyword := range pattern.Keywords {
+			state := int32(0)
+			for _, b := range []byte(strings.ToLower(keyword)) {
+				m.addClass(b)
+				child, ok := children[state][b]
+				if !ok {
+					child = int32(len(children))
+					children = append(children, map[byte]int32{})
+					outputs = append(outputs, nil)
+					children[state][b] = child
+				}
+				state = child
+			}
+			outputs[state] = append(outputs[state], i)
+		}
+	}
+
+	// Turn the trie into a deterministic automaton, following the failure
+	// links breadth first so each state inherits the transitions and outputs
+	// of the longest suffix that is also a keyword prefix
+	m.next = make([]int32, len(children)*m.numClasses)
+	fail := make([]int32, len(children))
+	var queue []int32
+	for b, child := range children[0] {
+		m.next[m.classes[b]] = child
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		state := queue[0]
+		queue = queue[1:]
+
+		outputs[state] = append(outputs[state], outputs[fail[state]]...)
+		copy(m.next[int(state)*m.numClasses:], m.next[int(fail[state])*m.numClasses:int(fail[state]+1)*m.numClasses])
+		for b, child := range children[state] {
+			fail[child] = m.next[int(fail[state])*m.numClasses+int(m.classes[b])]
+			m.next[int(state)*m.numClasses+int(m.classes[b])] = child
+			queue = append(queue, child)
+		}
+	}
+	m.outputs = outputs
+	return m
+}
+
+// addClass gives a byte class to a keyword byte, shared by both cases of
+// ASCII letters
+func (m *keywordMatcher) addClass(b byte) {
+	if m.classes[b] != 0 {
+		return
+	}
+
+	class := uint16(m.numClasses)
+	m.numClasses++
+	m.classes[b] = class
+	if 'a' <= b && b <= 'z' {
+		m.classes[b-'a'+'A'] = class
+	}
+}
+
+// candidates marks the patterns to evaluate on the line in selected, which
+// has one entry per pattern and must be cleared by the caller
+func (m *keywordMatcher) candidates(line string, selected []bool) {
+	for _, i := range m.always {
+		selected[i] = true
+	}
+
+	state := int32(0)
+	for j := 0; j < len(line); j++ {
+		state = m.next[int(state)*m.numClasses+int(m.classes[line[j]])]
+		for _, i := range m.outputs[state] {
+			selected[i] = true
+		}
+	}
+}
+
+// hasKeywords reports whether the pattern is limited to lines containing a
+// keyword. An empty keyword is found in every line.
+func hasKeywords(pattern DefinePatternInfo) bool {
+	for _, keyword := range pattern.Keywords {
+		if keyword == "" {
+			return false
+		}
+	}
+	return len(pattern.Keywords) > 0
+}
@@ -0,0 +1,80 @@
+package patterns
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// lineIndex maps the byte offsets of a text to 1-based line numbers and
+// character columns. Lines end with "\n" or "\r\n", like with bufio.ScanLines.
+type lineIndex struct {
+	text   string
+	starts []int // Byte offset of the start of every line
+}
+
+func newLineIndex(text string) lineIndex {
+	index := lineIndex{text: text}
+	for start := 0; start < len(text); {
+		index.starts = append(index.starts, start)
+		end := strings.IndexByte(text[start:], '\n')
+		if end < 0 {
+			break
+		}
+		start += end + 1
+	}
+	return index
+}
+
+// count returns the number of lines of the text
+func (l lineIndex) count() int {
+	return len(l.starts)
+}
+
+// line returns the text of the 1-based line, without its line ending
+func (l lineIndex) line(number int) string {
+	start := l.starts[number-1]
+	end := len(l.text)
+	if number < len(l.starts) {
+		end = l.starts[number] - 1
+	}
+	return strings.TrimSuffix(l.text[start:end], "\r")
+}
+
+// lines returns the text from the start of the first line to the end of the
+// last one, without the final line ending
+func (l lineIndex) lines(first int, last int) string {
+	if first == last {
+		return l.line(first)
+	}
+	end := len(l.text)
+	if last < len(l.starts) {
+		end = l.starts[last] - 1
+	}
+	return strings.TrimSuffix(l.text[l.starts[first-1]:end], "\r")
+}
+
+// position returns the 1-based line and character column of the byte offset
+func (l lineIndex) position(offset int) (int, int) {
+	number := sort.Search(len(l.starts), func(i int) bool { return l.starts[i] > offset })
+	if number == 0 {
+		// Only an empty text has no line
+		return 1, 1
+	}
+	return number, utf8.RuneCountInString(l.text[l.starts[number-1]:offset]) + 1
+}
+
+// span returns the first line and column and the last line and column, both
+// inclusive, of the text between the byte offsets
+func (l lineIndex) span(start int, end int) (int, int, int, int) {
+	startLine, startColumn := l.position(start)
+	if end <= start {
+		return startLine, startColumn, startLine, startColumn - 1
+	}
+
+	// The last character of the span may be a line ending, which belongs to
+	// the line it ends
+	_, lastRuneSize := utf8.DecodeLastRuneInString(l.text[start:end])
+	endLine, endColumn := l.position(end - lastRuneSize)
+	return startLine, startColumn, endLine, endColumn
+}
@@ -0,0 +1,269 @@
+package patterns
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Contexts of a match in a Markdown document
+const (
+	ContextText        = "text"         // Prose
+	ContextCodeBlock   = "code-block"   // Fenced code block, with the language of its info string
+	ContextInlineCode  = "inline-code"  // Code span between backticks
+	ContextLink        = "link"         // Destination of a link, autolink or link reference definition
+	ContextFrontMatter = "front-matter" // YAML or TOML front matter
+	ContextHeading     = "heading"      // ATX or setext heading
+	ContextTable       = "table"        // Row of a table
+)
+
+var contexts = []string{ContextText, ContextCodeBlock, ContextInlineCode, ContextLink, ContextFrontMatter, ContextHeading, ContextTable}
+
+// markdownExtensions are the extensions of the files parsed as Markdown
+var markdownExtensions = map[string]bool{
+	".md": true, ".markdown": true, ".mdown": true, ".mkd": true, ".mkdn": true, ".mdx": true,
+}
+
+var (
+	codeFence     = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})\\s*(.*)$")
+	atxHeading    = regexp.MustCompile(`^ {0,3}#{1,6}(?:\s|$)`)
+	setextUnder   = regexp.MustCompile(`^ {0,3}(?:=+|-+)\s*$`)
+	tableDelim    = regexp.MustCompile(`^\s*\|?\s*:?-+:?\s*(?:\|\s*:?-+:?\s*)*\|?\s*$`)
+	linkReference = regexp.MustCompile(`^ {0,3}\[[^\]]+\]:\s*(\S+)`)
+	inlineLink    = regexp.MustCompile(`\]\(\s*(<[^>]*>|[^\s)]*)`)
+	autolink      = regexp.MustCompile(`<[A-Za-z][A-Za-z0-9+.\-]{1,31}:[^\s<>]*>`)
+)
+
+// markdownLine is the block context of a line of a Markdown document
+type markdownLine struct {
+	context  string
+	language string // Lower-cased first word of the info string of a code block
+}
+
+// markdownDocument holds the block context of every line of a Markdown
+// document. Contexts inside a line, inline code and links, are found when a
+// match is classified. A nil document is not Markdown and has no contexts.
+type markdownDocument struct {
+	lines []markdownLine
+}
+
+// isMarkdown reports whether the file is a Markdown document, from its extension
+func isMarkdown(fileName string) bool {
+	return markdownExtensions[strings.ToLower(path.Ext(fileName))]
+}
+
+// parseMarkdown classifies the lines of the text when the file is a Markdown
+// document, and returns nil otherwise
+func parseMarkdown(fileName string, lines lineIndex) *markdownDocument {
+	if !isMarkdown(fileName) {
+		return nil
+	}
+
+	doc := &markdownDocument{lines: make([]markdownLine, lines.count())}
+	number := 1
+
+	// Front matter is only recognized on the very first line
+	if lines.count() > 0 {
+		if marker := lines.line(1); marker == "---" || marker == "+++" {
+			end := 2
+			for end <= lines.count() && strings.TrimSpace(lines.line(end)) != marker {
+				end++
+			}
+			if end <= lines.count() {
+				for ; number <= end; number++ {
+					doc.lines[number-1].context = ContextFrontMatter
+				}
+			}
+		}
+	}
+
+	for ; number <= lines.count(); number++ {
+		line := lines.line(number)
+		fence := codeFence.FindStringSubmatch(line)
+		// Backtick fences cannot have backticks in their info string
+		if fence == nil || (fence[1][0] == '`' && strings.Contains(fence[2], "`")) {
+			doc.lines[number-1].context = ContextText
+			continue
+		}
+
+		language := ""
+		if info := strings.Fields(fence[2]); len(info) > 0 {
+			language = strings.ToLower(strings.Trim(info[0], "{}."))
+		}
+		block := markdownLine{context: ContextCodeBlock, language: language}
+		doc.lines[number-1] = block
+
+		// The block runs to a closing fence at least as long as the opening
+		// one, or to the end of the document
+		for number++; number <= lines.count(); number++ {
+			doc.lines[number-1] = block
+			closing := strings.TrimSpace(lines.line(number))
+			if len(closing) >= len(fence[1]) && strings.Trim(closing, fence[1][:1]) == "" &&
+				len(lines.line(number))-len(strings.TrimLeft(lines.line(number), " ")) <= 3 {
+				break
+			}
+		}
+	}
+
+	doc.classifyText(lines)
+	return doc
+}
+
+// classifyText finds the headings and tables among the lines of prose
+func (doc *markdownDocument) classifyText(lines lineIndex) {
+	isText := func(number int) bool {
+		return number >= 1 && number <= lines.count() && doc.lines[number-1].context == ContextText
+	}
+	isBlank := func(number int) bool {
+		return strings.TrimSpace(lines.line(number)) == ""
+	}
+
+	for number := 1; number <= lines.count(); number++ {
+		if !isText(number) {
+			continue
+		}
+		line := lines.line(number)
+
+		switch {
+		case atxHeading.MatchString(line):
+			doc.lines[number-1].context = ContextHeading
+
+		case strings.Contains(line, "|") && tableDelim.MatchString(line) && isText(number-1) && strings.Contains(lines.line(number-1), "|"):
+			// The delimiter row follows the header row, the rows run to the
+			// first line without a cell
+			doc.lines[number-2].context = ContextTable
+			for ; isText(number) && !isBlank(number) && strings.Contains(lines.line(number), "|"); number++ {
+				doc.lines[number-1].context = ContextTable
+			}
+			number--
+
+		case setextUnder.MatchString(line) && isText(number-1) && !isBlank(number-1):
+			// The underline and the line it underlines
+			doc.lines[number-2].context = ContextHeading
+			doc.lines[number-1].context = ContextHeading
+		}
+	}
+}
+
+// context returns the context and the code block language of the byte offset
+// of the text. Inline code and links take precedence over the heading or
+// table they are part of.
+func (doc *markdownDocument) context(lines lineIndex, offset int) (string, string) {
+	if doc == nil {
+		return "", ""
+	}
+
+	number, _ := lines.position(offset)
+	block := doc.lines[number-1]
+	if block.context == ContextCodeBlock || block.context == ContextFrontMatter {
+		return block.context, block.language
+	}
+
+	line := lines.line(number)
+	column := offset - lines.starts[number-1]
+	if inlineCode(line, column) {
+		return ContextInlineCode, ""
+	}
+	if inLink(line, column) {
+		return ContextLink, ""
+	}
+	return block.context, ""
+}
+
+// inlineCode reports whether the byte at column of the line is inside a code
+// span: between a run of backticks and the next run of the same length
+func inlineCode(line string, column int) bool {
+	for i := 0; i < len(line); {
+		if line[i] != '`' {
+			i++
+			continue
+		}
+		opening := runLength(line, i, '`')
+		start := i + opening
+
+		// Look for a closing run of exactly the same length
+		end := -1
+		for j := start; j < len(line); {
+			if line[j] != '`' {
+				j++
+				continue
+			}
+			if closing := runLength(line, j, '`'); closing == opening {
+				end = j
+				break
+			} else {
+				j += closing
+			}
+		}
+		if end < 0 {
+			// A run without a closing one is literal text
+			i = start
+			continue
+		}
+		if column >= start && column < end {
+			return true
+		}
+		i = end + opening
+	}
+	return false
+}
+
+// inLink reports whether the byte at column of the line is part of the
+// destination of an inline link, of an autolink or of a link reference
+// definition
+func inLink(line string, column int) bool {
+	if group := linkReference.FindStringSubmatchIndex(line); group != nil && column >= group[2] && column < group[3] {
+		return true
+	}
+	for _, group := range inlineLink.FindAllStringSubmatchIndex(line, -1) {
+		if column >= group[2] && column < group[3] {
+			return true
+		}
+	}
+	for _, link := range autolink.FindAllStringIndex(line, -1) {
+		if column > link[0] && column < link[1]-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// runLength returns the number of consecutive c bytes starting at i
+func runLength(line string, i int, c byte) int {
+	n := 0
+	for i+n < len(line) && line[i+n] == c {
+		n++
+	}
+	return n
+}
+
+// matchesContext reports whether the context is one of the listed ones. A
+// listed "code-block:yaml" only covers the code blocks of that language.
+func matchesContext(listed []string, context string, language string) bool {
+	for _, entry := range listed {
+		kind, lang, hasLanguage := strings.Cut(entry, ":")
+		if kind == context && (!hasLanguage || strings.EqualFold(lang, language)) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseContexts validates the contexts listed in a config file
+func parseContexts(listed []string) error {
+	for _, entry := range listed {
+		kind, _, hasLanguage := strings.Cut(entry, ":")
+		if hasLanguage && kind != ContextCodeBlock {
+			return fmt.Errorf("invalid context %q, only %s contexts have a language", entry, ContextCodeBlock)
+		}
+		known := false
+		for _, context := range contexts {
+			known = known || kind == context
+		}
+		if !known {
+			return fmt.Errorf("invalid context %q, expected one of: %s", entry, strings.Join(contexts, ", "))
+		}
+	}
+	return nil
+}
@@ -1,97 +1,367 @@
 package patterns
 
 import (
-	"bufio"
+	"fmt"
 	"github.com/BurntSushi/toml"
-	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"io"
 	"log"
 	"regexp"
+	"sort"
+	"strings"
+	"sync"
 )
 
 // MatchResult represents the result of a regex match
 type MatchResult struct {
 	FileName    string
-	LineNumber  int
+	LineNumber  int // The line the match starts on
+	EndLine     int // The line the match ends on, after LineNumber for multi-line matches
+	StartColumn int // 1-based, counted in characters from the start of LineNumber
+	EndColumn   int // 1-based and inclusive, counted in characters from the start of EndLine
 	MatchString string
+	Secret      string // The part of the match holding the credential
+	SecretStart int    // 1-based, counted in characters from the start of the line the secret starts on
+	SecretEnd   int    // 1-based and inclusive, counted in characters from the start of the line the secret ends on
 	Pattern     string
+	RuleID      string
+	Severity    string
+	Confidence  string
+	Tags        []string
+	Remediation string
+	Entropy     float64 // Shannon entropy of the entropy group of the pattern
+	Placeholder string  // Why the secret looks like a placeholder, set when the match was downgraded
+	Context     string  // Markdown context of the secret, one of the Context constants, "" outside Markdown
+	Language    string  // Language of the code block the secret is in
+	Suppressed  bool    // A docser:allow comment marks the match as intended
+	Line        string  // The full lines the match was found on
 }
 
 // PatternConfig defines the structure of the TOML config file
 type PatternConfig struct {
-	Regex string `toml:"regex"`
-	Name  string `toml:"name"`
+	ID           string           `toml:"id"`
+	Regex        string           `toml:"regex"`
+	Name         string           `toml:"name"`
+	Keywords     []string         `toml:"keywords"`
+	Severity     string           `toml:"severity"`
+	Confidence   string           `toml:"confidence"`
+	Tags         []string         `toml:"tags"`
+	Remediation  string           `toml:"remediation"`
+	SecretGroup  int              `toml:"secretGroup"`
+	MultiLine    bool             `toml:"multiline"`
+	Entropy      float64          `toml:"entropy"`
+	EntropyGroup int              `toml:"entropyGroup"`
+	Placeholders string           `toml:"placeholders"`
+	Contexts     []string         `toml:"contexts"`
+	Allowlist    *AllowlistConfig `toml:"allowlist"`
 }
 
+// RuleConfig defines a gitleaks-style rule in the TOML config file
+type RuleConfig struct {
+	ID           string           `toml:"id"`
+	Description  string           `toml:"description"`
+	Regex        string           `toml:"regex"`
+	Keywords     []string         `toml:"keywords"`
+	Severity     string           `toml:"severity"`
+	Confidence   string           `toml:"confidence"`
+	Tags         []string         `toml:"tags"`
+	Remediation  string           `toml:"remediation"`
+	SecretGroup  int              `toml:"secretGroup"`
+	MultiLine    bool             `toml:"multiline"`
+	Entropy      float64          `toml:"entropy"`
+	EntropyGroup int              `toml:"entropyGroup"`
+	Placeholders string           `toml:"placeholders"`
+	Contexts     []string         `toml:"contexts"`
+	Path         string           `toml:"path"`
+	Allowlist    *AllowlistConfig `toml:"allowlist"`
+}
+
+// Config accepts both the docser `[[patterns]]` schema and the gitleaks
+// `[[rules]]` / `[allowlist]` schema, so a .gitleaks.toml can be passed as is.
 type Config struct {
-	Patterns []PatternConfig `toml:"patterns"`
+	Patterns     []PatternConfig    `toml:"patterns"`
+	Rules        []RuleConfig       `toml:"rules"`
+	Allowlist    AllowlistConfig    `toml:"allowlist"`
+	Placeholders PlaceholdersConfig `toml:"placeholders"`
 }
 
-// ProcessTextFileContentsWithRegex reads and processes the contents of a text-based file using regex patterns
-func ProcessTextFileContentsWithRegex(file *object.File, configFile string) ([]MatchResult, error) {
-	fileReader, err := file.Reader()
-	if err != nil {
-		return nil, err
-	}
-	defer func(fileReader io.ReadCloser) {
-		err := fileReader.Close()
-		if err != nil {
-			log.Println(err)
-		}
-	}(fileReader)
+// Ruleset holds the patterns and the global allowlist used during a scan
+type Ruleset struct {
+	Patterns  []DefinePatternInfo
+	Allowlist *Allowlist
+	byID      map[string]*DefinePatternInfo
+	keywords  *keywordMatcher
+	multiLine bool // Whether any pattern is matched against whole texts
 
-	var matchResults []MatchResult
+	unknownRules sync.Map // Unknown rule ids of docser:allow markers already reported, see warnUnknownRule
+}
+
+// RuleID returns the identifier of the pattern, derived from its description
+// when no explicit id was given
+func (p DefinePatternInfo) RuleID() string {
+	if p.ID != "" {
+		return p.ID
+	}
 
-	scanner := bufio.NewScanner(fileReader)
-	lineNumber := 0
+	var id strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(p.Description) {
+		if ('a' <= r && r <= 'z') || ('0' <= r && r <= '9') {
+			id.WriteRune(r)
+			lastDash = false
+		} else if !lastDash {
+			id.WriteByte('-')
+			lastDash = true
+		}
+	}
+	return strings.TrimSuffix(id.String(), "-")
+}
 
+// LoadRuleset returns the built-in patterns followed by the patterns and
+// allowlist of the given config file. The config file is optional. Rule ids
+// must be unique, as findings, allowlists and docser:allow markers refer to
+// patterns by id.
+func LoadRuleset(configFile string) (*Ruleset, error) {
 	// Load patterns from regex.go
-	allPatterns := append([]DefinePatternInfo{}, RegexPatterns...)
+	rs := &Ruleset{Patterns: append([]DefinePatternInfo{}, RegexPatterns...)}
 	// Load additional patterns from the config file
 	if configFile != "" {
-		configPatterns, err := loadPatternsFromConfigFile(configFile)
+		config, err := loadConfigFile(configFile)
 		if err != nil {
 			return nil, err
 		}
-		allPatterns = append(allPatterns, configPatterns...)
-	}
-
-	for scanner.Scan() {
-		line := scanner.Text()
-		lineNumber++
-
-		for _, patternInfo := range allPatterns {
-			regex := patternInfo.Pattern
-			if regex.MatchString(line) {
-				submatches := regex.FindStringSubmatch(line)
-				if len(submatches) > 0 {
-					matchResult := MatchResult{
-						FileName:    file.Name,
-						LineNumber:  lineNumber, // Line numbers are 1-based
-						MatchString: submatches[0],
-						Pattern:     patternInfo.Description,
-					}
-					matchResults = append(matchResults, matchResult)
+
+		configPatterns, err := compilePatterns(config)
+		if err != nil {
+			return nil, err
+		}
+		rs.Patterns = append(rs.Patterns, configPatterns...)
+
+		rs.Allowlist, err = config.Allowlist.compile()
+		if err != nil {
+			return nil, fmt.Errorf("invalid global allowlist: %w", err)
+		}
+
+		if err := config.Placeholders.apply(rs.Patterns); err != nil {
+			return nil, err
+		}
+	}
+
+	rs.byID = make(map[string]*DefinePatternInfo, len(rs.Patterns))
+	for i := range rs.Patterns {
+		id := rs.Patterns[i].RuleID()
+		if id == "" {
+			return nil, fmt.Errorf("pattern %q needs an id or a name", rs.Patterns[i].Pattern)
+		}
+		if _, ok := rs.byID[id]; ok {
+			return nil, fmt.Errorf("duplicate rule id %q", id)
+		}
+		rs.byID[id] = &rs.Patterns[i]
+		rs.multiLine = rs.multiLine || rs.Patterns[i].MultiLine
+	}
+	rs.keywords = newKeywordMatcher(rs.Patterns)
+	return rs, nil
+}
+
+// ProcessTextContentsWithRegex reads and processes text from any reader using regex
+// patterns, reporting the matches under the given file name. Patterns are
+// matched line by line, except multi-line ones which are matched against the
+// whole text.
+func ProcessTextContentsWithRegex(fileName string, reader io.Reader, rs *Ruleset) ([]MatchResult, error) {
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	text := string(contents)
+	lines := newLineIndex(text)
+	markdown := parseMarkdown(fileName, lines)
+
+	var matchResults []MatchResult
+	candidates := make([]bool, len(rs.Patterns))
+	applies := rs.appliesTo(fileName)
+
+	for lineNumber := 1; lineNumber <= lines.count(); lineNumber++ {
+		line := lines.line(lineNumber)
+		lineStart := lines.starts[lineNumber-1]
+
+		// Only run the regexes of the patterns with a keyword in the line
+		for i := range candidates {
+			candidates[i] = false
+		}
+		rs.keywords.candidates(line, candidates)
+
+		for i, patternInfo := range rs.Patterns {
+			if !candidates[i] || !applies[i] || patternInfo.MultiLine {
+				continue
+			}
+
+			submatches := patternInfo.Pattern.FindStringSubmatchIndex(line)
+			if submatches == nil {
+				continue
+			}
+			// Turn the offsets in the line into offsets in the text
+			for j := range submatches {
+				if submatches[j] >= 0 {
+					submatches[j] += lineStart
 				}
 			}
+
+			if matchResult, ok := rs.newMatchResult(fileName, lines, markdown, patternInfo, submatches); ok {
+				matchResults = append(matchResults, matchResult)
+			}
 		}
 	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+	if !rs.multiLine {
+		return matchResults, nil
+	}
+
+	// Match the multi-line patterns with a keyword anywhere in the text
+	for i := range candidates {
+		candidates[i] = false
+	}
+	rs.keywords.candidates(text, candidates)
+
+	for i, patternInfo := range rs.Patterns {
+		if !candidates[i] || !applies[i] || !patternInfo.MultiLine {
+			continue
+		}
+		for _, submatches := range patternInfo.Pattern.FindAllStringSubmatchIndex(text, -1) {
+			if matchResult, ok := rs.newMatchResult(fileName, lines, markdown, patternInfo, submatches); ok {
+				matchResults = append(matchResults, matchResult)
+			}
+		}
 	}
 
+	// Keep the matches in the order of the lines they start on
+	sort.SliceStable(matchResults, func(a, b int) bool {
+		return matchResults[a].LineNumber < matchResults[b].LineNumber
+	})
 	return matchResults, nil
 }
 
-func loadPatternsFromConfigFile(configFile string) ([]DefinePatternInfo, error) {
+// appliesTo tells which patterns apply to the file, the ones without a path
+// restriction or whose path regex matches the file name
+func (rs *Ruleset) appliesTo(fileName string) []bool {
+	applies := make([]bool, len(rs.Patterns))
+	for i, patternInfo := range rs.Patterns {
+		applies[i] = patternInfo.Path == nil || patternInfo.Path.MatchString(fileName)
+	}
+	return applies
+}
+
+// NameKey sums up what the matches of a text depend on in its file name:
+// whether it is Markdown, whose contexts patterns filter matches on, and which
+// of the patterns with a path restriction apply to it. Texts with the same
+// contents and key have the same matches, whatever their names.
+func (rs *Ruleset) NameKey(fileName string) string {
+	var key strings.Builder
+	if isMarkdown(fileName) {
+		key.WriteString("md:")
+	}
+	for _, patternInfo := range rs.Patterns {
+		if patternInfo.Path == nil {
+			continue
+		}
+		if patternInfo.Path.MatchString(fileName) {
+			key.WriteByte('1')
+		} else {
+			key.WriteByte('0')
+		}
+	}
+	return key.String()
+}
+
+// newMatchResult describes a match of the pattern at the byte offsets of the
+// submatches in the text. It returns false when the entropy of the match is
+// too low for it to be reported, or when its secret is a placeholder and the
+// pattern drops them, or when the pattern does not report matches in the
+// Markdown context of the secret. Placeholders of patterns downgrading them
+// are reported with info severity and low confidence.
+func (rs *Ruleset) newMatchResult(fileName string, lines lineIndex, markdown *markdownDocument, patternInfo DefinePatternInfo, submatches []int) (MatchResult, bool) {
+	text := lines.text
+	secretStart, secretEnd := patternInfo.secretBounds(submatches)
+	secret := text[secretStart:secretEnd]
+
+	entropyValue := secret
+	if patternInfo.EntropyGroup > 0 {
+		entropyValue = submatch(text, submatches, patternInfo.EntropyGroup)
+	}
+	entropy := shannonEntropy(entropyValue)
+	if patternInfo.Entropy > 0 && entropy <= patternInfo.Entropy {
+		// Like gitleaks, the entropy has to be above the threshold
+		return MatchResult{}, false
+	}
+
+	context, language := markdown.context(lines, secretStart)
+	if context != "" && len(patternInfo.Contexts) > 0 && !matchesContext(patternInfo.Contexts, context, language) {
+		return MatchResult{}, false
+	}
+
+	severity, confidence := patternInfo.Severity, patternInfo.Confidence
+	placeholder := ""
+	if patternInfo.Placeholders != PlaceholdersReport {
+		placeholder = placeholderReason(secret)
+	}
+	if placeholder != "" {
+		if patternInfo.Placeholders != PlaceholdersDowngrade {
+			return MatchResult{}, false
+		}
+		severity, confidence = SeverityInfo, ConfidenceLow
+	}
+
+	start, end := submatches[0], submatches[1]
+	startLine, startColumn, endLine, endColumn := lines.span(start, end)
+	_, secretStartColumn, _, secretEndColumn := lines.span(secretStart, secretEnd)
+	return MatchResult{
+		FileName:    fileName,
+		LineNumber:  startLine, // Line numbers are 1-based
+		EndLine:     endLine,
+		StartColumn: startColumn,
+		EndColumn:   endColumn,
+		MatchString: text[start:end],
+		Secret:      secret,
+		SecretStart: secretStartColumn,
+		SecretEnd:   secretEndColumn,
+		Pattern:     patternInfo.Description,
+		RuleID:      patternInfo.RuleID(),
+		Severity:    severity,
+		Confidence:  confidence,
+		Tags:        patternInfo.Tags,
+		Remediation: patternInfo.Remediation,
+		Entropy:     entropy,
+		Placeholder: placeholder,
+		Context:     context,
+		Language:    language,
+		Suppressed:  rs.isSuppressed(fileName, lines, startLine, patternInfo.RuleID()),
+		Line:        lines.lines(startLine, endLine),
+	}, true
+}
+
+// secretBounds returns the byte offsets of the secret in a match: the secret
+// group when the pattern has one, the only capture group of the regex like
+// gitleaks, and the whole match otherwise
+func (p DefinePatternInfo) secretBounds(submatches []int) (int, int) {
+	group := p.SecretGroup
+	if group == 0 && p.Pattern.NumSubexp() == 1 {
+		group = 1
+	}
+	if group > 0 && 2*group+1 < len(submatches) && submatches[2*group] >= 0 {
+		return submatches[2*group], submatches[2*group+1]
+	}
+	return submatches[0], submatches[1]
+}
+
+func loadConfigFile(configFile string) (*Config, error) {
 	// Read and parse the TOML config file
 	var config Config
 	_, err := toml.DecodeFile(configFile, &config)
 	if err != nil {
 		return nil, err
 	}
+	return &config, nil
+}
 
+func compilePatterns(config *Config) ([]DefinePatternInfo, error) {
 	var configPatterns []DefinePatternInfo
 
 	// Compile the regex patterns from the config file
@@ -103,8 +373,94 @@ func loadPatternsFromConfigFile(configFile string) ([]DefinePatternInfo, error)
 
 		// Create a DefinePatternInfo and add it to the configPatterns slice
 		configPattern := DefinePatternInfo{
-			Pattern:     regex,
-			Description: pattern.Name,
+			Pattern:      regex,
+			Description:  pattern.Name,
+			ID:           pattern.ID,
+			Keywords:     pattern.Keywords,
+			Tags:         pattern.Tags,
+			Remediation:  pattern.Remediation,
+			SecretGroup:  pattern.SecretGroup,
+			MultiLine:    pattern.MultiLine,
+			Entropy:      pattern.Entropy,
+			EntropyGroup: pattern.EntropyGroup,
+			Contexts:     pattern.Contexts,
+		}
+		configPattern.Severity, configPattern.Confidence, err = parseLevels(pattern.Severity, pattern.Confidence)
+		if err == nil {
+			configPattern.Placeholders, err = parsePlaceholders(pattern.Placeholders)
+		}
+		if err == nil {
+			err = parseContexts(pattern.Contexts)
+		}
+		if err == nil {
+			err = checkGroups(configPattern)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("pattern %q: %w", configPattern.RuleID(), err)
+		}
+		if pattern.Allowlist != nil {
+			configPattern.Allowlist, err = pattern.Allowlist.compile()
+			if err != nil {
+				return nil, fmt.Errorf("pattern %q: invalid allowlist: %w", configPattern.RuleID(), err)
+			}
+		}
+
+		configPatterns = append(configPatterns, configPattern)
+	}
+
+	// Compile the gitleaks-style rules from the config file
+	for _, rule := range config.Rules {
+		if rule.Regex == "" {
+			// Path-only gitleaks rules have nothing to match against document contents
+			log.Printf("[!] Skipping rule %q without a regex\n", rule.ID)
+			continue
+		}
+
+		regex, err := regexp.Compile(rule.Regex)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+		}
+
+		configPattern := DefinePatternInfo{
+			Pattern:      regex,
+			Description:  rule.Description,
+			ID:           rule.ID,
+			Keywords:     rule.Keywords,
+			Tags:         rule.Tags,
+			Remediation:  rule.Remediation,
+			SecretGroup:  rule.SecretGroup,
+			MultiLine:    rule.MultiLine,
+			Entropy:      rule.Entropy,
+			EntropyGroup: rule.EntropyGroup,
+			Contexts:     rule.Contexts,
+		}
+		if configPattern.Description == "" {
+			configPattern.Description = rule.ID
+		}
+		if rule.Path != "" {
+			configPattern.Path, err = regexp.Compile(rule.Path)
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid path: %w", rule.ID, err)
+			}
+		}
+		configPattern.Severity, configPattern.Confidence, err = parseLevels(rule.Severity, rule.Confidence)
+		if err == nil {
+			configPattern.Placeholders, err = parsePlaceholders(rule.Placeholders)
+		}
+		if err == nil {
+			err = parseContexts(rule.Contexts)
+		}
+		if err == nil {
+			err = checkGroups(configPattern)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: %w", rule.ID, err)
+		}
+		if rule.Allowlist != nil {
+			configPattern.Allowlist, err = rule.Allowlist.compile()
+			if err != nil {
+				return nil, fmt.Errorf("rule %q: invalid allowlist: %w", rule.ID, err)
+			}
 		}
 
 		configPatterns = append(configPatterns, configPattern)
@@ -112,3 +468,16 @@ func loadPatternsFromConfigFile(configFile string) ([]DefinePatternInfo, error)
 
 	return configPatterns, nil
 }
+
+// checkGroups makes sure the secret and entropy groups of a configured pattern
+// are capture groups of its regex
+func checkGroups(pattern DefinePatternInfo) error {
+	groups := pattern.Pattern.NumSubexp()
+	if pattern.SecretGroup < 0 || pattern.SecretGroup > groups {
+		return fmt.Errorf("secretGroup %d does not exist, the regex has %d capture groups", pattern.SecretGroup, groups)
+	}
+	if pattern.EntropyGroup < 0 || pattern.EntropyGroup > groups {
+		return fmt.Errorf("entropyGroup %d does not exist, the regex has %d capture groups", pattern.EntropyGroup, groups)
+	}
+	return nil
+}
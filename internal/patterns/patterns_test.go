@@ -0,0 +1,96 @@
+package patterns
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadRulesetRuleIDs(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		err    string
+	}{
+		{
+			name: "unique ids",
+			config: `
+[[patterns]]
+id = "internal-token"
+regex = "itk_[a-z0-9]{16}"
+
+[[patterns]]
+name = "Internal Secret"
+regex = "isk_[a-z0-9]{16}"
+
+[[rules]]
+id = "internal-key"
+regex = "ikey_[a-z0-9]{16}"
+`,
+		},
+		{
+			name: "two patterns with the same id",
+			config: `
+[[patterns]]
+id = "internal-token"
+regex = "itk_[a-z0-9]{16}"
+
+[[rules]]
+id = "internal-token"
+regex = "itk2_[a-z0-9]{16}"
+`,
+			err: `duplicate rule id "internal-token"`,
+		},
+		{
+			name: "id derived from the name of another pattern",
+			config: `
+[[patterns]]
+id = "internal-token"
+regex = "itk_[a-z0-9]{16}"
+
+[[patterns]]
+name = "Internal Token"
+regex = "itk2_[a-z0-9]{16}"
+`,
+			err: `duplicate rule id "internal-token"`,
+		},
+		{
+			name: "id of a built-in pattern",
+			config: `
+[[rules]]
+id = "slack-token"
+regex = "xoxz-[0-9]{12}"
+`,
+			err: `duplicate rule id "slack-token"`,
+		},
+		{
+			name: "pattern without an id or a name",
+			config: `
+[[patterns]]
+regex = "itk_[a-z0-9]{16}"
+`,
+			err: "needs an id or a name",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configFile := filepath.Join(t.TempDir(), "docser.toml")
+			if err := os.WriteFile(configFile, []byte(tt.config), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			_, err := LoadRuleset(configFile)
+			if tt.err == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Fatalf("got error %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package patterns
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity levels of a pattern, from the least to the most severe
+const (
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Confidence levels of a pattern, telling how likely a match is a real secret
+const (
+	ConfidenceLow    = "low"
+	ConfidenceMedium = "medium"
+	ConfidenceHigh   = "high"
+)
+
+var (
+	severities  = []string{SeverityInfo, SeverityLow, SeverityMedium, SeverityHigh, SeverityCritical}
+	confidences = []string{ConfidenceLow, ConfidenceMedium, ConfidenceHigh}
+)
+
+// parseLevels validates the severity and confidence of a configured pattern.
+// Patterns that do not set them are of medium severity and confidence.
+func parseLevels(severity string, confidence string) (string, string, error) {
+	severity, err := parseLevel("severity", severity, severities, SeverityMedium)
+	if err != nil {
+		return "", "", err
+	}
+	confidence, err = parseLevel("confidence", confidence, confidences, ConfidenceMedium)
+	if err != nil {
+		return "", "", err
+	}
+	return severity, confidence, nil
+}
+
+// parseLevel lower-cases a severity or confidence read from a config file and
+// checks it is one of the allowed levels. An empty value gives the fallback.
+func parseLevel(kind string, value string, allowed []string, fallback string) (string, error) {
+	if value == "" {
+		return fallback, nil
+	}
+
+	value = strings.ToLower(strings.TrimSpace(value))
+	for _, level := range allowed {
+		if value == level {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("invalid %s %q, expected one of: %s", kind, value, strings.Join(allowed, ", "))
+}
@@ -0,0 +1,63 @@
+package patterns
+
+import (
+	"log"
+	"regexp"
+	"strings"
+)
+
+// suppressionMarker finds a docser:allow marker in a comment: Markdown and
+// HTML comments, "#", "//", "/*", "--" and ";" comments, and RST comments,
+// which are lines starting with "..". Line comment markers must start the
+// line or follow a space, so URL fragments are not taken for comments. The
+// marker may be followed by the ids of the rules it suppresses, then by free
+// text after a "--" separator.
+var suppressionMarker = regexp.MustCompile(`(?:<!--|/\*|(?:^|\s)(?:#|//|--|;)|^\s*\.\.)\s*docser:allow\b(.*)`)
+
+// isSuppressed reports whether a docser:allow marker on the line a match
+// starts on, or on the line before, covers the rule of the match
+func (rs *Ruleset) isSuppressed(fileName string, lines lineIndex, lineNumber int, ruleID string) bool {
+	if rs.suppresses(fileName, lines.line(lineNumber), ruleID) {
+		return true
+	}
+	return lineNumber > 1 && rs.suppresses(fileName, lines.line(lineNumber-1), ruleID)
+}
+
+// suppresses reports whether the line holds a marker for the given rule. A
+// bare marker covers every rule. A marker followed by rule ids only covers
+// those rules; ids that are not rules of the ruleset are reported, so a typo
+// never suppresses anything.
+func (rs *Ruleset) suppresses(fileName string, line string, ruleID string) bool {
+	if !strings.Contains(line, "docser:allow") {
+		return false
+	}
+
+	for _, marker := range suppressionMarker.FindAllStringSubmatch(line, -1) {
+		// Drop the end of the comment and the free text, keep the rule ids
+		rest := strings.NewReplacer("-->", " ", "*/", " ", ",", " ").Replace(marker[1])
+		if i := strings.Index(rest, "--"); i >= 0 {
+			rest = rest[:i]
+		}
+		ids := strings.Fields(rest)
+		if len(ids) == 0 {
+			return true
+		}
+		for _, id := range ids {
+			if id == ruleID {
+				return true
+			}
+			if _, ok := rs.byID[id]; !ok {
+				rs.warnUnknownRule(fileName, id)
+			}
+		}
+	}
+	return false
+}
+
+// warnUnknownRule logs a docser:allow marker naming a rule that does not
+// exist, once per file and id
+func (rs *Ruleset) warnUnknownRule(fileName string, id string) {
+	if _, warned := rs.unknownRules.LoadOrStore(fileName+"\x00"+id, true); !warned {
+		log.Printf("[!] Unknown rule %q in docser:allow comment of %s, nothing suppressed\n", id, fileName)
+	}
+}
@@ -0,0 +1,108 @@
+package patterns
+
+import "testing"
+
+func TestSuppresses(t *testing.T) {
+	rs, err := LoadRuleset("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		line string
+		want bool
+	}{
+		{"no marker", "token = xoxb-123", false},
+		{"hash comment", "token = xoxb-123 # docser:allow", true},
+		{"slash comment", "token: xoxb-123 // docser:allow", true},
+		{"block comment", "token: xoxb-123 /* docser:allow */", true},
+		{"sql comment", "-- docser:allow", true},
+		{"ini comment", "; docser:allow", true},
+		{"html comment", "<!-- docser:allow -->", true},
+		{"rst comment", ".. docser:allow", true},
+		{"indented rst comment", "   .. docser:allow", true},
+		{"comment at line start", "#docser:allow", true},
+
+		// The marker must be in a comment
+		{"plain text", "use docser:allow to suppress a finding", false},
+		{"url fragment", "see http://x/#docser:allow", false},
+		{"url fragment with rule", "see https://example.com/docs#docser:allow slack-token", false},
+		{"url path", "see http://x//docser:allow", false},
+		{"longer word", "# docser:allowed", false},
+
+		// Rule ids restrict the marker
+		{"matching rule", "# docser:allow slack-token", true},
+		{"other rule", "# docser:allow firebase-url", false},
+		{"rule list", "# docser:allow firebase-url, slack-token", true},
+		{"rule list without commas", "# docser:allow firebase-url slack-token", true},
+		{"rule in html comment", "<!-- docser:allow slack-token -->", true},
+		{"other rule in html comment", "<!-- docser:allow firebase-url -->", false},
+		{"rule in block comment", "/* docser:allow slack-token */", true},
+
+		// Free text after "--" is not taken for rule ids
+		{"reason after separator", "# docser:allow -- sample token from the docs", true},
+		{"rule and reason", "# docser:allow slack-token -- sample token", true},
+		{"other rule and reason", "# docser:allow firebase-url -- slack-token sample", false},
+		{"reason in html comment", "<!-- docser:allow slack-token -- sample -->", true},
+
+		// Unknown ids suppress nothing
+		{"unknown rule", "# docser:allow slack-tokn", false},
+		{"unknown and matching rule", "# docser:allow slack-tokn slack-token", true},
+		{"second marker", "x # docser:allow firebase-url // docser:allow slack-token", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rs.suppresses("doc.md", tt.line, "slack-token"); got != tt.want {
+				t.Errorf("suppresses(%q) = %v, want %v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSuppressesWarnsUnknownRules(t *testing.T) {
+	rs, err := LoadRuleset("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs.suppresses("doc.md", "# docser:allow slack-tokn firebase-url", "cloudinary")
+	if _, ok := rs.unknownRules.Load("doc.md\x00slack-tokn"); !ok {
+		t.Error("the unknown rule id was not reported")
+	}
+	if _, ok := rs.unknownRules.Load("doc.md\x00firebase-url"); ok {
+		t.Error("a known rule id was reported")
+	}
+}
+
+func TestIsSuppressed(t *testing.T) {
+	rs, err := LoadRuleset("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := newLineIndex("# docser:allow slack-token\n" +
+		"token: xoxb-1\n" +
+		"token: xoxb-2\n" +
+		"token: xoxb-3 # docser:allow\n" +
+		"token: xoxb-4\n")
+
+	tests := []struct {
+		lineNumber int
+		want       bool
+	}{
+		{1, true}, // The marker line itself
+		{2, true}, // The line after the marker
+		{3, false},
+		{4, true},
+		{5, true},
+	}
+	for _, tt := range tests {
+		if got := rs.isSuppressed("doc.md", lines, tt.lineNumber, "slack-token"); got != tt.want {
+			t.Errorf("line %d: suppressed %v, want %v", tt.lineNumber, got, tt.want)
+		}
+	}
+	if rs.isSuppressed("doc.md", lines, 2, "firebase-url") {
+		t.Error("a marker naming another rule suppressed the match")
+	}
+}
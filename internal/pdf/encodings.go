@@ -0,0 +1,62 @@
+package pdf
+
+// The encodings of simple fonts. Only the characters likely to be part of a
+// secret need to be right: ASCII is the same in all of them, other codes map to
+// their usual characters where it is cheap to do so.
+var (
+	standardEncoding = newEncoding(map[int]string{0x27: "’", 0x60: "‘"}, nil)
+	winAnsiEncoding  = newEncoding(map[int]string{
+		0x80: "€", 0x82: "‚", 0x83: "ƒ", 0x84: "„", 0x85: "…", 0x86: "†", 0x87: "‡",
+		0x88: "ˆ", 0x89: "‰", 0x8A: "Š", 0x8B: "‹", 0x8C: "Œ", 0x8E: "Ž", 0x91: "‘",
+		0x92: "’", 0x93: "“", 0x94: "”", 0x95: "•", 0x96: "–", 0x97: "—", 0x98: "˜",
+		0x99: "™", 0x9A: "š", 0x9B: "›", 0x9C: "œ", 0x9E: "ž", 0x9F: "Ÿ",
+	}, latin1)
+	macRomanEncoding = newEncoding(nil, macRomanHigh)
+)
+
+// latin1 maps the codes from 0xA0 to 0xFF to the same code points
+func latin1(code int) string {
+	if code >= 0xA0 {
+		return string(rune(code))
+	}
+	return ""
+}
+
+// macRoman holds the characters of the codes from 0x80 to 0xFF of MacRomanEncoding
+var macRoman = []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»… ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ")
+
+func macRomanHigh(code int) string {
+	if code >= 0x80 && code-0x80 < len(macRoman) {
+		return string(macRoman[code-0x80])
+	}
+	return ""
+}
+
+// newEncoding builds an encoding from printable ASCII, the exceptions and the
+// function giving the characters of the codes above 0x7F
+func newEncoding(exceptions map[int]string, high func(int) string) [256]string {
+	var encoding [256]string
+	for code := 0x20; code < 0x7F; code++ {
+		encoding[code] = string(rune(code))
+	}
+	if high != nil {
+		for code := 0x80; code < 0x100; code++ {
+			encoding[code] = high(code)
+		}
+	}
+	for code, text := range exceptions {
+		encoding[code] = text
+	}
+	return encoding
+}
+
+// namedEncoding returns the predefined encoding with the given name
+func namedEncoding(encoding name) [256]string {
+	switch encoding {
+	case "WinAnsiEncoding":
+		return winAnsiEncoding
+	case "MacRomanEncoding", "MacExpertEncoding":
+		return macRomanEncoding
+	}
+	return standardEncoding
+}
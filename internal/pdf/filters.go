@@ -0,0 +1,301 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxStreamSize limits the size of a decoded stream, so a small compressed
+// stream cannot take all the memory
+const maxStreamSize = 64 << 20
+
+// errDecodeBudget is returned for the streams decoded once the document has no
+// decoded data budget left
+var errDecodeBudget = errors.New("decoded data budget exceeded")
+
+// decode returns the data of the stream with its filters applied. Results are
+// cached, and count against the decoded data budget of the document.
+func (doc *document) decode(s *stream) ([]byte, error) {
+	if d, ok := doc.decoded[s]; ok {
+		return d.data, d.err
+	}
+
+	var d decodedStream
+	if doc.decodedBudget <= 0 {
+		d.err = errDecodeBudget
+		doc.truncated = true
+	} else {
+		d.data, d.err = doc.applyFilters(s)
+		doc.decodedBudget -= len(d.data)
+	}
+	doc.decoded[s] = d
+	return d.data, d.err
+}
+
+// applyFilters applies the filters of the stream to its data
+func (doc *document) applyFilters(s *stream) ([]byte, error) {
+	var filters, parms array
+	switch v := doc.resolve(s.dict["Filter"]).(type) {
+	case name:
+		filters = array{v}
+		parms = array{s.dict["DecodeParms"]}
+	case array:
+		filters = v
+		parms, _ = doc.resolve(s.dict["DecodeParms"]).(array)
+	}
+
+	data := s.data
+	for i, filter := range filters {
+		var parm dict
+		if i < len(parms) {
+			parm = doc.dict(parms[i])
+		}
+
+		var err error
+		switch doc.resolve(filter) {
+		case name("FlateDecode"), name("Fl"):
+			data, err = inflate(data)
+			if err == nil {
+				data, err = doc.unpredict(data, parm)
+			}
+		case name("LZWDecode"), name("LZW"):
+			data, err = lzwDecode(data, doc.number(parm["EarlyChange"], 1) != 0)
+			if err == nil {
+				data, err = doc.unpredict(data, parm)
+			}
+		case name("ASCIIHexDecode"), name("AHx"):
+			data, err = asciiHexDecode(data)
+		case name("ASCII85Decode"), name("A85"):
+			data, err = ascii85Decode(data)
+		case name("RunLengthDecode"), name("RL"):
+			data, err = runLengthDecode(data)
+		case name("Crypt"):
+			// Only the identity crypt filter can be found in unencrypted documents
+		default:
+			// Image filters hold no text
+			return nil, fmt.Errorf("unsupported filter %v", filter)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// inflate decompresses zlib data. Truncated or corrupt streams are common, so
+// whatever could be decompressed before an error is kept.
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else if len(data) > 2 {
+		// Some writers get the zlib header wrong, try the raw deflate data
+		r = flate.NewReader(bytes.NewReader(data[2:]))
+	} else {
+		return nil, err
+	}
+
+	out, err := io.ReadAll(io.LimitReader(r, maxStreamSize))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+// unpredict reverts the PNG and TIFF predictors applied before compression
+func (doc *document) unpredict(data []byte, parm dict) ([]byte, error) {
+	predictor := int(doc.number(parm["Predictor"], 1))
+	if predictor <= 1 {
+		return data, nil
+	}
+
+	colors := int(doc.number(parm["Colors"], 1))
+	bits := int(doc.number(parm["BitsPerComponent"], 8))
+	columns := int(doc.number(parm["Columns"], 1))
+	bytesPerPixel := (colors*bits + 7) / 8
+	rowSize := (colors*bits*columns + 7) / 8
+	if bytesPerPixel < 1 || rowSize < 1 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+
+	if predictor == 2 {
+		if bits != 8 {
+			return nil, fmt.Errorf("unsupported TIFF predictor with %d bits per component", bits)
+		}
+		out := append([]byte{}, data...)
+		for row := 0; row+rowSize <= len(out); row += rowSize {
+			for i := row + bytesPerPixel; i < row+rowSize; i++ {
+				out[i] += out[i-bytesPerPixel]
+			}
+		}
+		return out, nil
+	}
+
+	// PNG predictors prefix every row with the byte of its filter type
+	var out []byte
+	previous := make([]byte, rowSize)
+	for pos := 0; pos < len(data); pos += rowSize + 1 {
+		end := min(pos+rowSize+1, len(data))
+		filterType := data[pos]
+		row := make([]byte, rowSize)
+		copy(row, data[pos+1:end])
+
+		for i := range row {
+			var left, upLeft byte
+			if i >= bytesPerPixel {
+				left, upLeft = row[i-bytesPerPixel], previous[i-bytesPerPixel]
+			}
+			up := previous[i]
+			switch filterType {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row[:end-pos-1]...)
+		previous = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	if pa <= pb && pa <= pc {
+		return a
+	}
+	if pb <= pc {
+		return b
+	}
+	return c
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// lzwDecode decompresses LZW data. The standard library decoder cannot be used
+// because PDF codes usually grow one code early.
+func lzwDecode(data []byte, earlyChange bool) ([]byte, error) {
+	const clear, eod = 256, 257
+	var out []byte
+	var table [][]byte
+	reset := func() {
+		table = table[:0]
+		for i := 0; i < 256; i++ {
+			table = append(table, []byte{byte(i)})
+		}
+		table = append(table, nil, nil) // Clear and end of data codes
+	}
+	reset()
+
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+	width := 9
+	var bitBuffer uint32
+	bitCount := 0
+	var previous []byte
+	for _, b := range data {
+		bitBuffer = bitBuffer<<8 | uint32(b)
+		bitCount += 8
+		for bitCount >= width {
+			code := int(bitBuffer>>(bitCount-width)) & (1<<width - 1)
+			bitCount -= width
+
+			switch {
+			case code == clear:
+				reset()
+				width, previous = 9, nil
+				continue
+			case code == eod:
+				return out, nil
+			}
+
+			var entry []byte
+			switch {
+			case code < len(table) && table[code] != nil:
+				entry = table[code]
+			case code == len(table) && previous != nil:
+				entry = append(append([]byte{}, previous...), previous[0])
+			default:
+				return out, fmt.Errorf("invalid LZW code %d", code)
+			}
+			out = append(out, entry...)
+			if len(out) > maxStreamSize {
+				return nil, fmt.Errorf("LZW stream too large")
+			}
+
+			if previous != nil {
+				table = append(table, append(append([]byte{}, previous...), entry[0]))
+			}
+			previous = entry
+			if len(table)+early >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return out, nil
+}
+
+// asciiHexDecode decodes hex digits up to the ">" end marker
+func asciiHexDecode(data []byte) ([]byte, error) {
+	if i := bytes.IndexByte(data, '>'); i >= 0 {
+		data = data[:i]
+	}
+	l := &lexer{data: append(append([]byte{'<'}, data...), '>')}
+	s, err := l.hexString()
+	return []byte(s), err
+}
+
+// ascii85Decode decodes base-85 data up to the "~>" end marker
+func ascii85Decode(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	out := make([]byte, 4*len(data)/5+4)
+	n, _, err := ascii85.Decode(out, data, true)
+	if err != nil {
+		return nil, err
+	}
+	return out[:n], nil
+}
+
+// runLengthDecode expands the runs of a RunLengthDecode stream
+func runLengthDecode(data []byte) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		i++
+		switch {
+		case length == 128:
+			return out, nil
+		case length < 128:
+			end := min(i+length+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case i < len(data):
+			out = append(out, bytes.Repeat(data[i:i+1], 257-length)...)
+			i++
+		}
+		if len(out) > maxStreamSize {
+			return nil, fmt.Errorf("run length stream too large")
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,381 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font turns the character codes of shown strings into text and widths
+type font struct {
+	toUnicode   *cmap       // The ToUnicode CMap of the font, when it has one
+	codespace   []codeRange // Byte lengths of the codes, from the encoding or ToUnicode CMap
+	codeLength  int         // Length of the codes outside of the codespace
+	encoding    [256]string // Text of the codes of simple fonts
+	widths      map[int]float64
+	missing     float64 // Width of the codes without one, in glyph space
+	widthScale  float64 // From glyph space to text space
+	singleBytes bool    // Simple fonts, where code 32 is a word space
+}
+
+// glyph is a character code of a shown string
+type glyph struct {
+	text      string
+	width     float64 // In text space, before the font size is applied
+	wordSpace bool    // The single byte code 32, which word spacing applies to
+}
+
+// defaultWidth is used for simple fonts that do not give their widths, like
+// the standard 14 fonts, about the average width of a Latin letter
+const defaultWidth = 500
+
+// loadFont reads a font dictionary
+func (doc *document) loadFont(d dict) *font {
+	f := &font{widths: make(map[int]float64), widthScale: 0.001, codeLength: 1, singleBytes: true}
+
+	subtype := doc.resolve(d["Subtype"])
+	if subtype == name("Type0") {
+		f.loadType0(doc, d)
+	} else {
+		f.loadSimple(doc, d, subtype == name("Type3"))
+	}
+
+	if s, ok := doc.resolve(d["ToUnicode"]).(*stream); ok {
+		if data, err := doc.decode(s); err == nil {
+			f.toUnicode = parseCMap(data)
+			if len(f.codespace) == 0 {
+				f.codespace = f.toUnicode.codespace
+			}
+		}
+	}
+	return f
+}
+
+// loadSimple reads the encoding and widths of a font with single byte codes
+func (f *font) loadSimple(doc *document, d dict, type3 bool) {
+	if type3 {
+		if m, ok := doc.resolve(d["FontMatrix"]).(array); ok && len(m) == 6 {
+			f.widthScale = doc.number(m[0], 0.001)
+		}
+	}
+
+	descriptor := doc.dict(d["FontDescriptor"])
+	f.missing = doc.number(descriptor["MissingWidth"], 0)
+	if widths, ok := doc.resolve(d["Widths"]).(array); ok {
+		first := int(doc.number(d["FirstChar"], 0))
+		for i, w := range widths {
+			f.widths[first+i] = doc.number(w, 0)
+		}
+	} else if f.missing == 0 {
+		f.missing = defaultWidth
+	}
+
+	f.encoding = standardEncoding
+	switch encoding := doc.resolve(d["Encoding"]).(type) {
+	case name:
+		f.encoding = namedEncoding(encoding)
+	case dict:
+		if base, ok := doc.resolve(encoding["BaseEncoding"]).(name); ok {
+			f.encoding = namedEncoding(base)
+		}
+		differences, _ := doc.resolve(encoding["Differences"]).(array)
+		code := 0
+		for _, entry := range differences {
+			switch v := doc.resolve(entry).(type) {
+			case int64:
+				code = int(v)
+			case float64:
+				code = int(v)
+			case name:
+				if code >= 0 && code < 256 {
+					f.encoding[code] = glyphText(string(v))
+				}
+				code++
+			}
+		}
+	}
+}
+
+// loadType0 reads the code lengths and the widths of a composite font
+func (f *font) loadType0(doc *document, d dict) {
+	f.singleBytes = false
+	f.codeLength = 2
+	f.missing = 1000
+
+	switch encoding := doc.resolve(d["Encoding"]).(type) {
+	case *stream:
+		if data, err := doc.decode(encoding); err == nil {
+			f.codespace = parseCMap(data).codespace
+		}
+	}
+
+	descendants, _ := doc.resolve(d["DescendantFonts"]).(array)
+	if len(descendants) == 0 {
+		return
+	}
+	descendant := doc.dict(descendants[0])
+	f.missing = doc.number(descendant["DW"], 1000)
+
+	// W lists "first [w1 w2 ...]" and "first last w" entries
+	w, _ := doc.resolve(descendant["W"]).(array)
+	for i := 0; i+1 < len(w); {
+		first := int(doc.number(w[i], 0))
+		if widths, ok := doc.resolve(w[i+1]).(array); ok {
+			for j, width := range widths {
+				f.widths[first+j] = doc.number(width, 0)
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			break
+		}
+		last := int(doc.number(w[i+1], 0))
+		width := doc.number(w[i+2], 0)
+		for code := first; code <= last && code-first < 65536; code++ {
+			f.widths[code] = width
+		}
+		i += 3
+	}
+}
+
+// decode splits a shown string into glyphs
+func (f *font) decode(s string) []glyph {
+	var glyphs []glyph
+	for i := 0; i < len(s); {
+		n := f.nextLength(s[i:])
+		code := 0
+		for _, b := range []byte(s[i : i+n]) {
+			code = code<<8 | int(b)
+		}
+
+		g := glyph{wordSpace: f.singleBytes && code == 32}
+		width, ok := f.widths[code]
+		if !ok {
+			width = f.missing
+		}
+		g.width = width * f.widthScale
+
+		if text, ok := f.toUnicode.lookup(code, n); ok {
+			g.text = text
+		} else if n == 1 {
+			g.text = f.encoding[code]
+		}
+		glyphs = append(glyphs, g)
+		i += n
+	}
+	return glyphs
+}
+
+// nextLength returns the length of the code at the start of s
+func (f *font) nextLength(s string) int {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, r := range f.codespace {
+			if r.length == n && r.contains(s[:n]) {
+				return n
+			}
+		}
+	}
+	return min(f.codeLength, len(s))
+}
+
+// codeRange is a codespace range of a CMap: codes of its length whose every
+// byte is within the bounds of the same byte of low and high
+type codeRange struct {
+	length    int
+	low, high string
+}
+
+func (r codeRange) contains(code string) bool {
+	for i := 0; i < r.length; i++ {
+		if code[i] < r.low[i] || code[i] > r.high[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// cmap maps character codes to text
+type cmap struct {
+	codespace []codeRange
+	chars     map[cmapKey]string
+	ranges    []cmapRange
+}
+
+type cmapKey struct {
+	code   int
+	length int
+}
+
+// cmapRange maps the codes from low to high to consecutive texts starting
+// with text, or to the texts of the list
+type cmapRange struct {
+	low, high int
+	length    int
+	text      string
+	list      []string
+}
+
+// lookup returns the text of the code, if the CMap maps it
+func (c *cmap) lookup(code int, length int) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	if text, ok := c.chars[cmapKey{code: code, length: length}]; ok {
+		return text, true
+	}
+	for _, r := range c.ranges {
+		if r.length != length || code < r.low || code > r.high {
+			continue
+		}
+		if r.list != nil {
+			if code-r.low < len(r.list) {
+				return r.list[code-r.low], true
+			}
+			return "", false
+		}
+		// The last character of the text is incremented along the range
+		runes := []rune(r.text)
+		if len(runes) == 0 {
+			return "", true
+		}
+		runes[len(runes)-1] += rune(code - r.low)
+		return string(runes), true
+	}
+	return "", false
+}
+
+// parseCMap reads the codespace ranges and the bfchar and bfrange mappings of a CMap
+func parseCMap(data []byte) *cmap {
+	c := &cmap{chars: make(map[cmapKey]string)}
+	l := &lexer{data: data}
+
+	var operands []interface{}
+	for {
+		tok, err := l.token()
+		if err != nil {
+			break
+		}
+		if tok == arrayStart || tok == dictStart {
+			tok, _ = l.complete(tok, 0)
+		}
+		if kw, ok := tok.(keyword); ok {
+			switch kw {
+			case "endcodespacerange":
+				for i := 0; i+1 < len(operands); i += 2 {
+					low, ok1 := operands[i].(string)
+					high, ok2 := operands[i+1].(string)
+					if ok1 && ok2 && len(low) == len(high) && len(low) > 0 && len(low) <= 4 {
+						c.codespace = append(c.codespace, codeRange{length: len(low), low: low, high: high})
+					}
+				}
+			case "endbfchar":
+				for i := 0; i+1 < len(operands); i += 2 {
+					src, ok := operands[i].(string)
+					if ok && len(src) > 0 && len(src) <= 4 {
+						c.chars[cmapKey{code: codeValue(src), length: len(src)}] = cmapText(operands[i+1])
+					}
+				}
+			case "endbfrange":
+				for i := 0; i+2 < len(operands); i += 3 {
+					low, ok1 := operands[i].(string)
+					high, ok2 := operands[i+1].(string)
+					if !ok1 || !ok2 || len(low) == 0 || len(low) > 4 {
+						continue
+					}
+					r := cmapRange{low: codeValue(low), high: codeValue(high), length: len(low)}
+					if list, ok := operands[i+2].(array); ok {
+						for _, item := range list {
+							r.list = append(r.list, cmapText(item))
+						}
+						if r.list == nil {
+							r.list = []string{}
+						}
+					} else {
+						r.text = cmapText(operands[i+2])
+					}
+					c.ranges = append(c.ranges, r)
+				}
+			}
+			operands = operands[:0]
+			continue
+		}
+		operands = append(operands, tok)
+	}
+	return c
+}
+
+// codeValue returns the big-endian value of the bytes of a code
+func codeValue(code string) int {
+	v := 0
+	for _, b := range []byte(code) {
+		v = v<<8 | int(b)
+	}
+	return v
+}
+
+// cmapText decodes the destination of a mapping: UTF-16BE text, or a glyph name
+func cmapText(obj interface{}) string {
+	switch v := obj.(type) {
+	case string:
+		units := make([]uint16, 0, len(v)/2)
+		for i := 0; i+1 < len(v); i += 2 {
+			units = append(units, uint16(v[i])<<8|uint16(v[i+1]))
+		}
+		return string(utf16.Decode(units))
+	case name:
+		return glyphText(string(v))
+	}
+	return ""
+}
+
+// glyphText returns the text of a glyph name: single characters, the names of
+// ASCII characters and ligatures, and uniXXXX and uXXXX names
+func glyphText(glyphName string) string {
+	// Suffixes name variants of the same glyph, like "a.sc" or "one.oldstyle"
+	if i := strings.IndexByte(glyphName, '.'); i > 0 {
+		glyphName = glyphName[:i]
+	}
+	if text, ok := glyphNames[glyphName]; ok {
+		return text
+	}
+	if len(glyphName) == 1 {
+		return glyphName
+	}
+	if strings.HasPrefix(glyphName, "uni") && len(glyphName) >= 7 {
+		var b strings.Builder
+		for i := 3; i+4 <= len(glyphName); i += 4 {
+			v, err := strconv.ParseUint(glyphName[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			b.WriteRune(rune(v))
+		}
+		return b.String()
+	}
+	if strings.HasPrefix(glyphName, "u") && len(glyphName) >= 5 && len(glyphName) <= 7 {
+		if v, err := strconv.ParseUint(glyphName[1:], 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+	return ""
+}
+
+// glyphNames holds the names of the glyphs of the ASCII characters and of the
+// common punctuation and ligatures. Letters are named after themselves.
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#", "dollar": "$",
+	"percent": "%", "ampersand": "&", "quotesingle": "'", "quoteright": "’",
+	"parenleft": "(", "parenright": ")", "asterisk": "*", "plus": "+", "comma": ",",
+	"hyphen": "-", "minus": "-", "period": ".", "slash": "/", "zero": "0", "one": "1",
+	"two": "2", "three": "3", "four": "4", "five": "5", "six": "6", "seven": "7",
+	"eight": "8", "nine": "9", "colon": ":", "semicolon": ";", "less": "<",
+	"equal": "=", "greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "asciicircum": "^", "underscore": "_",
+	"grave": "`", "quoteleft": "‘", "braceleft": "{", "bar": "|",
+	"braceright": "}", "asciitilde": "~", "bullet": "•", "endash": "–",
+	"emdash": "—", "quotedblleft": "“", "quotedblright": "”",
+	"ellipsis": "…", "nbspace": " ", "fi": "fi", "fl": "fl", "ff": "ff",
+	"ffi": "ffi", "ffl": "ffl", "dotlessi": "ı", "copyright": "©",
+	"registered": "®", "trademark": "™", "degree": "°", "section": "§",
+}
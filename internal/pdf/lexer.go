@@ -0,0 +1,361 @@
+package pdf
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// PDF objects are represented by these Go types: nil for null, bool, int64,
+// float64, string for strings (their raw bytes), name, array, dict, ref and
+// *stream.
+type (
+	name  string
+	array []interface{}
+	dict  map[name]interface{}
+)
+
+// ref is an indirect reference to the object with the given number
+type ref struct {
+	num int64
+	gen int64
+}
+
+// stream is a dictionary followed by a byte sequence, still encoded with the
+// filters of the dictionary
+type stream struct {
+	dict dict
+	data []byte
+}
+
+// keyword is an operator or a keyword such as obj, R or endstream
+type keyword string
+
+// Delimiter tokens, returned as keywords
+const (
+	arrayStart keyword = "["
+	arrayEnd   keyword = "]"
+	dictStart  keyword = "<<"
+	dictEnd    keyword = ">>"
+)
+
+var errEOF = errors.New("unexpected end of data")
+
+// lexer reads the tokens of PDF syntax from data, starting at pos
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhitespace(c byte) bool {
+	return c == 0 || c == '\t' || c == '\n' || c == '\f' || c == '\r' || c == ' '
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips the whitespace and the comments at the current position
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhitespace(c) {
+			l.pos++
+		} else if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		} else {
+			return
+		}
+	}
+}
+
+// token returns the next token: a keyword for delimiters, operators and
+// keywords, or the object for numbers, strings and names
+func (l *lexer) token() (interface{}, error) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, errEOF
+	}
+
+	c := l.data[l.pos]
+	switch {
+	case c == '(':
+		return l.literalString()
+	case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+		l.pos += 2
+		return dictStart, nil
+	case c == '<':
+		return l.hexString()
+	case c == '>' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '>':
+		l.pos += 2
+		return dictEnd, nil
+	case c == '[':
+		l.pos++
+		return arrayStart, nil
+	case c == ']':
+		l.pos++
+		return arrayEnd, nil
+	case c == '/':
+		return l.name(), nil
+	case isDelimiter(c):
+		// Stray delimiters such as ")" or "{" are skipped like unknown keywords
+		l.pos++
+		return keyword(c), nil
+	}
+
+	start := l.pos
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	word := string(l.data[start:l.pos])
+	if number, ok := parseNumber(word); ok {
+		return number, nil
+	}
+	switch word {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	return keyword(word), nil
+}
+
+// parseNumber parses an integer or a real number
+func parseNumber(word string) (interface{}, bool) {
+	if word == "" {
+		return nil, false
+	}
+	c := word[0]
+	if c != '+' && c != '-' && c != '.' && (c < '0' || c > '9') {
+		return nil, false
+	}
+	if n, err := strconv.ParseInt(word, 10, 64); err == nil {
+		return n, true
+	}
+	if f, err := strconv.ParseFloat(word, 64); err == nil {
+		return f, true
+	}
+	// Some writers output numbers like "--1" or "1.2.3", readers take what they can
+	end := 1
+	for end < len(word) && strings.IndexByte("0123456789.", word[end]) >= 0 {
+		end++
+	}
+	if f, err := strconv.ParseFloat(strings.TrimLeft(word[:end], "+-"), 64); err == nil {
+		if c == '-' {
+			f = -f
+		}
+		return f, true
+	}
+	return nil, false
+}
+
+// name reads a name, decoding its #xx escapes
+func (l *lexer) name() name {
+	l.pos++ // Skip the slash
+	var b []byte
+	for l.pos < len(l.data) && !isWhitespace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		c := l.data[l.pos]
+		if c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+		b = append(b, c)
+		l.pos++
+	}
+	return name(b)
+}
+
+// literalString reads a string between balanced parentheses, decoding its escapes
+func (l *lexer) literalString() (string, error) {
+	l.pos++ // Skip the opening parenthesis
+	var b []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(b), nil
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return string(b), nil
+			}
+			c = l.data[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// A backslash at the end of a line continues the string
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if '0' <= c && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && '0' <= l.data[l.pos] && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+		b = append(b, c)
+	}
+	return string(b), nil
+}
+
+// hexString reads a string of hex digits between angle brackets
+func (l *lexer) hexString() (string, error) {
+	l.pos++ // Skip the opening bracket
+	var b []byte
+	var digit byte
+	odd := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			if odd {
+				// A missing last digit is zero
+				b = append(b, digit<<4)
+			}
+			return string(b), nil
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if odd {
+			b = append(b, digit<<4|v)
+		} else {
+			digit = v
+		}
+		odd = !odd
+	}
+	return string(b), nil
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// object reads a complete object: arrays and dictionaries are read up to their
+// end, and "num gen R" is turned into a ref. Streams are not handled here.
+func (l *lexer) object() (interface{}, error) {
+	tok, err := l.token()
+	if err != nil {
+		return nil, err
+	}
+	return l.complete(tok, 0)
+}
+
+// maxDepth limits the nesting of arrays and dictionaries
+const maxDepth = 100
+
+func (l *lexer) complete(tok interface{}, depth int) (interface{}, error) {
+	if depth > maxDepth {
+		return nil, fmt.Errorf("objects nested too deeply")
+	}
+
+	switch tok {
+	case arrayStart:
+		var a array
+		for {
+			tok, err := l.token()
+			if err != nil {
+				return a, err
+			}
+			if tok == arrayEnd {
+				return a, nil
+			}
+			obj, err := l.complete(tok, depth+1)
+			if err != nil {
+				return a, err
+			}
+			a = append(a, obj)
+		}
+
+	case dictStart:
+		d := dict{}
+		for {
+			tok, err := l.token()
+			if err != nil {
+				return d, err
+			}
+			if tok == dictEnd {
+				return d, nil
+			}
+			key, ok := tok.(name)
+			if !ok {
+				// Skip anything that is not a key, like a broken writer would
+				continue
+			}
+			tok, err = l.token()
+			if err != nil {
+				return d, err
+			}
+			if tok == dictEnd {
+				return d, nil
+			}
+			value, err := l.complete(tok, depth+1)
+			if err != nil {
+				return d, err
+			}
+			d[key] = value
+		}
+
+	case arrayEnd, dictEnd:
+		return nil, fmt.Errorf("unexpected %s", tok)
+	}
+
+	// A number may start a "num gen R" reference
+	if num, ok := tok.(int64); ok {
+		saved := l.pos
+		if gen, err := l.token(); err == nil {
+			if gen, ok := gen.(int64); ok {
+				if r, err := l.token(); err == nil && r == keyword("R") {
+					return ref{num: num, gen: gen}, nil
+				}
+			}
+		}
+		l.pos = saved
+	}
+	return tok, nil
+}
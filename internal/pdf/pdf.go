@@ -0,0 +1,405 @@
+// Package pdf extracts the text of PDF documents so it can be matched like any
+// other text. It reads the objects of a document, including compressed object
+// streams, walks its page tree and interprets the text operators of every
+// page. Encrypted documents are not supported.
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var (
+	// ErrNotPDF is returned for data that does not start with a PDF header
+	ErrNotPDF = errors.New("not a PDF document")
+	// ErrEncrypted is returned for encrypted documents, whose strings and streams cannot be read
+	ErrEncrypted = errors.New("encrypted PDF documents are not supported")
+	// ErrTruncated is returned along with the text extracted so far when a
+	// document takes too much content or decoded data to be read in full
+	ErrTruncated = errors.New("PDF document too complex, only part of its text was extracted")
+)
+
+// The budgets of a document. Legitimate documents stay far below them, while
+// documents built to expand, like forms drawing each other many times or
+// streams inflating to a lot of data, are cut short.
+const (
+	maxPageContent     = 32 << 20  // Bytes of content streams interpreted for a page
+	maxDocumentContent = 256 << 20 // Bytes of content streams interpreted for the whole document
+	maxDocumentDecoded = 512 << 20 // Bytes of decoded stream data for the whole document
+)
+
+// objectHeader matches the "num gen obj" line starting an indirect object
+var objectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// IsPDF reports whether the data starts with a PDF header. Like most readers,
+// garbage of up to 1 KB is allowed before the header.
+func IsPDF(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte("%PDF-"))
+}
+
+// document holds the objects of a PDF document
+type document struct {
+	objects  map[int64]definition
+	trailers []dict
+
+	decoded       map[*stream]decodedStream // Streams are only decoded once
+	decodedBudget int                       // Bytes of decoded data left, see maxDocumentDecoded
+	contentBudget int                       // Bytes of content left to interpret, see maxDocumentContent
+	truncated     bool                      // A budget ran out
+}
+
+// decodedStream is the result of decoding a stream
+type decodedStream struct {
+	data []byte
+	err  error
+}
+
+// definition is the latest definition of an object in the file. Objects are
+// located by scanning the file instead of trusting the cross-reference table,
+// so incremental updates are honored by keeping the last definition.
+type definition struct {
+	offset int
+	object interface{}
+}
+
+// ExtractText returns the text of every page of the document, in page order.
+// Lines of text are separated by "\n". Pages whose contents cannot be read
+// have an empty text. When the document runs out of budget, the text
+// extracted so far is returned with ErrTruncated.
+func ExtractText(data []byte) ([]string, error) {
+	if !IsPDF(data) {
+		return nil, ErrNotPDF
+	}
+
+	doc := load(data)
+	for _, trailer := range doc.trailers {
+		if _, ok := trailer["Encrypt"]; ok {
+			return nil, ErrEncrypted
+		}
+	}
+
+	pages, err := doc.pages()
+	if err != nil {
+		return nil, err
+	}
+
+	texts := make([]string, len(pages))
+	for i, page := range pages {
+		texts[i] = doc.pageText(page)
+	}
+	if doc.truncated {
+		return texts, ErrTruncated
+	}
+	return texts, nil
+}
+
+// load finds every indirect object and trailer of the data, then unpacks the
+// object streams
+func load(data []byte) *document {
+	doc := &document{
+		objects:       make(map[int64]definition),
+		decoded:       make(map[*stream]decodedStream),
+		decodedBudget: maxDocumentDecoded,
+		contentBudget: maxDocumentContent,
+	}
+
+	for pos := 0; pos < len(data); {
+		loc := objectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[0]
+		// The object number must not be the end of another token
+		if start > 0 && !isWhitespace(data[start-1]) && !isDelimiter(data[start-1]) {
+			pos = start + 1
+			continue
+		}
+
+		num, _ := parseNumber(string(data[pos+loc[2] : pos+loc[3]]))
+		l := &lexer{data: data, pos: pos + loc[1]}
+		obj, end, err := readObject(l)
+		if err != nil {
+			pos = pos + loc[1]
+			continue
+		}
+		if n, ok := num.(int64); ok {
+			doc.objects[n] = definition{offset: start, object: obj}
+		}
+		pos = end
+	}
+
+	doc.findTrailers(data)
+	doc.unpackObjectStreams()
+	return doc
+}
+
+// readObject reads the object following an object header, with the data of
+// its stream when it has one. It returns the offset following the object.
+func readObject(l *lexer) (interface{}, int, error) {
+	obj, err := l.object()
+	if err != nil && err != errEOF {
+		return nil, 0, err
+	}
+
+	d, ok := obj.(dict)
+	if !ok {
+		return obj, l.pos, nil
+	}
+	saved := l.pos
+	if tok, err := l.token(); err != nil || tok != keyword("stream") {
+		l.pos = saved
+		return obj, l.pos, nil
+	}
+
+	// The data starts after the end of line following the keyword
+	start := l.pos
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+
+	// Trust the length only when endstream follows it
+	if length, ok := d["Length"].(int64); ok && length >= 0 && start+int(length) <= len(l.data) {
+		end := start + int(length)
+		rest := bytes.TrimLeft(l.data[end:min(end+32, len(l.data))], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return &stream{dict: d, data: l.data[start:end]}, end, nil
+		}
+	}
+
+	end := bytes.Index(l.data[start:], []byte("endstream"))
+	if end < 0 {
+		return &stream{dict: d, data: l.data[start:]}, len(l.data), nil
+	}
+	streamData := bytes.TrimSuffix(l.data[start:start+end], []byte("\n"))
+	streamData = bytes.TrimSuffix(streamData, []byte("\r"))
+	return &stream{dict: d, data: streamData}, start + end, nil
+}
+
+// findTrailers reads the trailer dictionaries and the dictionaries of the
+// cross-reference streams, which hold the same entries, in file order
+func (doc *document) findTrailers(data []byte) {
+	type located struct {
+		offset  int
+		trailer dict
+	}
+	var found []located
+
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		l := &lexer{data: data, pos: pos + i + len("trailer")}
+		if obj, err := l.object(); err == nil {
+			if d, ok := obj.(dict); ok {
+				found = append(found, located{offset: pos + i, trailer: d})
+			}
+		}
+		pos += i + len("trailer")
+	}
+
+	for _, def := range doc.objects {
+		if s, ok := def.object.(*stream); ok && s.dict["Type"] == name("XRef") {
+			found = append(found, located{offset: def.offset, trailer: s.dict})
+		}
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].offset < found[j].offset })
+	for _, f := range found {
+		doc.trailers = append(doc.trailers, f.trailer)
+	}
+}
+
+// unpackObjectStreams adds the objects compressed in object streams. Such an
+// object replaces an uncompressed definition found before the object stream.
+func (doc *document) unpackObjectStreams() {
+	// Sort the object streams so the result does not depend on map ordering
+	var containers []definition
+	for _, def := range doc.objects {
+		if s, ok := def.object.(*stream); ok && s.dict["Type"] == name("ObjStm") {
+			containers = append(containers, def)
+		}
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i].offset < containers[j].offset })
+
+	for _, container := range containers {
+		s := container.object.(*stream)
+		data, err := doc.decode(s)
+		if err != nil {
+			continue
+		}
+		n, _ := doc.resolve(s.dict["N"]).(int64)
+		first, _ := doc.resolve(s.dict["First"]).(int64)
+		if first < 0 || int(first) > len(data) {
+			continue
+		}
+
+		// The stream starts with N pairs of object numbers and offsets
+		l := &lexer{data: data}
+		for i := int64(0); i < n; i++ {
+			num, err1 := l.token()
+			offset, err2 := l.token()
+			if err1 != nil || err2 != nil {
+				break
+			}
+			num64, ok1 := num.(int64)
+			offset64, ok2 := offset.(int64)
+			if !ok1 || !ok2 || int(first+offset64) >= len(data) {
+				continue
+			}
+			if def, ok := doc.objects[num64]; ok && def.offset > container.offset {
+				continue
+			}
+
+			objLexer := &lexer{data: data, pos: int(first + offset64)}
+			obj, err := objLexer.object()
+			if err != nil && err != errEOF {
+				continue
+			}
+			doc.objects[num64] = definition{offset: container.offset, object: obj}
+		}
+	}
+}
+
+// maxResolve limits the chains of references followed by resolve
+const maxResolve = 32
+
+// resolve follows references until it reaches a direct object. Missing objects are null.
+func (doc *document) resolve(obj interface{}) interface{} {
+	for i := 0; i < maxResolve; i++ {
+		r, ok := obj.(ref)
+		if !ok {
+			return obj
+		}
+		obj = doc.objects[r.num].object
+	}
+	return nil
+}
+
+// dict resolves the object and returns it as a dictionary. The dictionary of a
+// stream is returned for streams.
+func (doc *document) dict(obj interface{}) dict {
+	switch v := doc.resolve(obj).(type) {
+	case dict:
+		return v
+	case *stream:
+		return v.dict
+	}
+	return nil
+}
+
+// number resolves the object and returns it as a float, with the fallback for
+// anything that is not a number
+func (doc *document) number(obj interface{}, fallback float64) float64 {
+	switch v := doc.resolve(obj).(type) {
+	case int64:
+		return float64(v)
+	case float64:
+		return v
+	}
+	return fallback
+}
+
+// catalog returns the document catalog, from the last trailer naming one or
+// from any catalog object when the trailers are missing or broken
+func (doc *document) catalog() dict {
+	for i := len(doc.trailers) - 1; i >= 0; i-- {
+		if root := doc.dict(doc.trailers[i]["Root"]); root != nil {
+			return root
+		}
+	}
+
+	var nums []int64
+	for num := range doc.objects {
+		nums = append(nums, num)
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+	for _, num := range nums {
+		if d, ok := doc.objects[num].object.(dict); ok && d["Type"] == name("Catalog") {
+			return d
+		}
+	}
+	return nil
+}
+
+// page is a leaf of the page tree with the resources it inherits
+type page struct {
+	dict      dict
+	resources dict
+}
+
+// maxPages limits the size of the page trees that are walked
+const maxPages = 100000
+
+// pages walks the page tree of the document
+func (doc *document) pages() ([]page, error) {
+	catalog := doc.catalog()
+	if catalog == nil {
+		return nil, fmt.Errorf("document catalog not found")
+	}
+
+	var pages []page
+	visited := make(map[interface{}]bool)
+	var walk func(node interface{}, resources dict, depth int)
+	walk = func(node interface{}, resources dict, depth int) {
+		if r, ok := node.(ref); ok {
+			if visited[r] {
+				return
+			}
+			visited[r] = true
+		}
+		d := doc.dict(node)
+		if d == nil || depth > maxDepth || len(pages) >= maxPages {
+			return
+		}
+		if res := doc.dict(d["Resources"]); res != nil {
+			resources = res
+		}
+
+		kids, isTree := doc.resolve(d["Kids"]).(array)
+		if !isTree {
+			pages = append(pages, page{dict: d, resources: resources})
+			return
+		}
+		for _, kid := range kids {
+			walk(kid, resources, depth+1)
+		}
+	}
+	walk(catalog["Pages"], nil, 0)
+	return pages, nil
+}
+
+// pageText returns the text of the content streams of the page
+func (doc *document) pageText(p page) string {
+	var contents [][]byte
+	switch v := doc.resolve(p.dict["Contents"]).(type) {
+	case *stream:
+		if data, err := doc.decode(v); err == nil {
+			contents = append(contents, data)
+		}
+	case array:
+		for _, part := range v {
+			if s, ok := doc.resolve(part).(*stream); ok {
+				if data, err := doc.decode(s); err == nil {
+					contents = append(contents, data)
+				}
+			}
+		}
+	}
+
+	// The content streams of a page are one stream split in parts, tokens
+	// may even span two parts
+	t := newTextExtractor(doc)
+	t.run(bytes.Join(contents, []byte("\n")), p.resources, identity, 0)
+	return t.text()
+}
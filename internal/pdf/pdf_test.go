@@ -0,0 +1,310 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// buildPDF lays out the objects, numbered from 1, followed by the trailer.
+// There is no cross-reference table, the reader finds objects by scanning.
+func buildPDF(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.7\n")
+	for i, obj := range objects {
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	fmt.Fprintf(&b, "trailer\n%s\n%%%%EOF\n", trailer)
+	return b.Bytes()
+}
+
+// streamObject returns a stream object with the dictionary entries and data
+func streamObject(entries string, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", entries, len(data), data)
+}
+
+// flateStream returns a stream object holding the compressed data
+func flateStream(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(data))
+	w.Close()
+	return streamObject("/Filter /FlateDecode", b.String())
+}
+
+// objectStream returns an object stream holding the objects, numbered from first
+func objectStream(first int, objects ...string) string {
+	var header, body strings.Builder
+	for i, obj := range objects {
+		fmt.Fprintf(&header, "%d %d ", first+i, body.Len())
+		body.WriteString(obj + " ")
+	}
+	return streamObject(fmt.Sprintf("/Type /ObjStm /N %d /First %d", len(objects), header.Len()), header.String()+body.String())
+}
+
+// helvetica is a simple font without widths, like the standard 14 fonts
+const helvetica = "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"
+
+// onePage builds a document of one page showing the content, with F1 as
+// Helvetica. Extra objects are numbered from 6 and the page resources may
+// refer to them.
+func onePage(resources string, content string, extra ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> " + resources + " >> >>",
+		streamObject("", content),
+		helvetica,
+	}
+	return buildPDF("<< /Root 1 0 R >>", append(objects, extra...)...)
+}
+
+const toUnicode = `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+2 beginbfchar
+<0001> <0041>
+<0002> <0042>
+endbfchar
+1 beginbfrange
+<0010> <0019> <0030>
+endbfrange
+endcmap
+end end`
+
+func TestExtractText(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+		err  error
+	}{
+		{
+			name: "shown string",
+			data: onePage("", "BT /F1 12 Tf 72 720 Td (Hello world) Tj ET"),
+			want: []string{"Hello world"},
+		},
+		{
+			name: "lines moved with Td",
+			data: onePage("", "BT /F1 12 Tf 72 720 Td (first) Tj 0 -14 Td (second) Tj ET"),
+			want: []string{"first\nsecond"},
+		},
+		{
+			name: "lines moved with leading",
+			data: onePage("", "BT /F1 10 Tf 14 TL 72 720 Td (one) Tj T* (two) Tj (three) ' ET"),
+			want: []string{"one\ntwo\nthree"},
+		},
+		{
+			name: "lines moved with cm",
+			data: onePage("", "q 1 0 0 1 72 700 cm BT /F1 12 Tf (top) Tj ET Q q 1 0 0 1 72 680 cm BT /F1 12 Tf (bottom) Tj ET Q"),
+			want: []string{"top\nbottom"},
+		},
+		{
+			name: "kerning and word gaps",
+			data: onePage("", "BT /F1 12 Tf 72 720 Td [(aws_access_key_id = AKIA) -20 (QWERTY)] TJ 0 -14 Td [(split) -600 (words)] TJ ET"),
+			want: []string{"aws_access_key_id = AKIAQWERTY\nsplit words"},
+		},
+		{
+			name: "string pieces shown one after the other",
+			data: onePage("", "BT /F1 12 Tf 72 720 Td (ghp_) Tj (q8Rk2Lm9) Tj ET"),
+			want: []string{"ghp_q8Rk2Lm9"},
+		},
+		{
+			name: "escapes and hex strings",
+			data: onePage("", `BT /F1 12 Tf 72 720 Td (a\(b\)c\101\
+d) Tj <2D 4A4b> Tj ET`),
+			want: []string{"a(b)cAd-JK"},
+		},
+		{
+			name: "compressed content",
+			data: buildPDF("<< /Root 1 0 R >>",
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+				flateStream("BT /F1 12 Tf 72 720 Td (compressed) Tj ET"),
+				helvetica,
+			),
+			want: []string{"compressed"},
+		},
+		{
+			name: "composite font with ToUnicode",
+			data: onePage("/Font << /F2 6 0 R >>", "BT /F2 12 Tf 72 720 Td <000100020010001300190002> Tj ET",
+				"<< /Type /Font /Subtype /Type0 /BaseFont /Foo /Encoding /Identity-H /DescendantFonts [8 0 R] /ToUnicode 7 0 R >>",
+				streamObject("", toUnicode),
+				"<< /Type /Font /Subtype /CIDFontType2 /BaseFont /Foo /DW 600 >>",
+			),
+			want: []string{"AB039B"},
+		},
+		{
+			name: "encoding differences",
+			data: onePage("/Font << /F2 6 0 R >>", "BT /F2 12 Tf 72 720 Td (AB) Tj ET",
+				"<< /Type /Font /Subtype /Type1 /BaseFont /Foo /Encoding << /BaseEncoding /WinAnsiEncoding /Differences [65 /B /A] >> >>",
+			),
+			want: []string{"BA"},
+		},
+		{
+			name: "form drawing text",
+			data: onePage("/XObject << /Fm1 6 0 R >>", "BT /F1 12 Tf 72 720 Td (page) Tj ET /Fm1 Do",
+				streamObject("/Type /XObject /Subtype /Form /BBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> >>",
+					"BT /F1 12 Tf 72 600 Td (form) Tj ET"),
+			),
+			want: []string{"page\nform"},
+		},
+		{
+			name: "form drawing itself",
+			data: onePage("/XObject << /X 6 0 R >>", "/X Do",
+				streamObject("/Type /XObject /Subtype /Form /BBox [0 0 612 792] /Resources << /Font << /F1 5 0 R >> /XObject << /X 6 0 R >> >>",
+					"BT /F1 12 Tf 72 600 Td (once) Tj ET /X Do /X Do"),
+			),
+			want: []string{"once"},
+		},
+		{
+			name: "inline image",
+			data: onePage("", "BT /F1 12 Tf 72 720 Td (before) Tj ET BI /W 2 /H 2 /BPC 8 /CS /G ID \x00EI\xff\x01 EI BT /F1 12 Tf 72 700 Td (after) Tj ET"),
+			want: []string{"before\nafter"},
+		},
+		{
+			name: "several pages",
+			data: buildPDF("<< /Root 1 0 R >>",
+				"<< /Type /Catalog /Pages 2 0 R >>",
+				"<< /Type /Pages /Kids [3 0 R 4 0 R] /Count 2 /Resources << /Font << /F1 5 0 R >> >> >>",
+				"<< /Type /Page /Parent 2 0 R /Contents 6 0 R >>",
+				"<< /Type /Page /Parent 2 0 R /Contents [7 0 R 8 0 R] >>",
+				helvetica,
+				streamObject("", "BT /F1 12 Tf 72 720 Td (first page) Tj ET"),
+				streamObject("", "BT /F1 12 Tf 72 720 Td (second"),
+				streamObject("", " page) Tj ET"),
+			),
+			want: []string{"first page", "second page"},
+		},
+		{
+			name: "object stream",
+			data: buildPDF("<< /Root 4 0 R >>",
+				streamObject("", "BT /F1 12 Tf 72 720 Td (packed) Tj ET"),
+				helvetica,
+				objectStream(4,
+					"<< /Type /Catalog /Pages 5 0 R >>",
+					"<< /Type /Pages /Kids [6 0 R] /Count 1 >>",
+					"<< /Type /Page /Parent 5 0 R /Contents 1 0 R /Resources << /Font << /F1 2 0 R >> >> >>",
+				),
+			),
+			want: []string{"packed"},
+		},
+		{
+			name: "incremental update",
+			data: append(onePage("", "BT /F1 12 Tf 72 720 Td (old) Tj ET"),
+				"4 0 obj\n"+streamObject("", "BT /F1 12 Tf 72 720 Td (new) Tj ET")+"\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF\n"...),
+			want: []string{"new"},
+		},
+		{
+			name: "encrypted",
+			data: buildPDF("<< /Root 1 0 R /Encrypt << /Filter /Standard >> >>", "<< /Type /Catalog /Pages 2 0 R >>"),
+			err:  ErrEncrypted,
+		},
+		{
+			name: "not a PDF",
+			data: []byte("# Title\n\nSome Markdown"),
+			err:  ErrNotPDF,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ExtractText(test.data)
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ExtractText() error = %v, want %v", err, test.err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("ExtractText() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// expandingForms builds a document whose page draws a chain of forms, each
+// drawing the next one the given number of times. The last form draws
+// itself.
+func expandingForms(forms int, draws int) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> /XObject << /X 6 0 R >> >> >>",
+		streamObject("", "BT /F1 12 Tf 72 720 Td (start) Tj ET /X Do"),
+		helvetica,
+	}
+	for i := 0; i < forms; i++ {
+		next := 6 + i + 1
+		if i == forms-1 {
+			next = 6 + i
+		}
+		content := "BT /F1 1 Tf (x) Tj ET" + strings.Repeat(" /X Do", draws)
+		objects = append(objects, streamObject(
+			fmt.Sprintf("/Type /XObject /Subtype /Form /Resources << /Font << /F1 5 0 R >> /XObject << /X %d 0 R >> >>", next),
+			content))
+	}
+	return buildPDF("<< /Root 1 0 R >>", objects...)
+}
+
+// TestExtractTextExpandingForms checks that documents drawing forms over and
+// over are read in bounded time
+func TestExtractTextExpandingForms(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "form drawing itself", data: expandingForms(1, 8)},
+		{name: "forms drawing each other", data: expandingForms(maxFormDepth, 8), err: ErrTruncated},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			start := time.Now()
+			got, err := ExtractText(test.data)
+			if elapsed := time.Since(start); elapsed > 20*time.Second {
+				t.Fatalf("ExtractText() took %v", elapsed)
+			}
+			if !errors.Is(err, test.err) {
+				t.Fatalf("ExtractText() error = %v, want %v", err, test.err)
+			}
+			if len(got) != 1 || !strings.HasPrefix(got[0], "start") {
+				t.Errorf("ExtractText() = %.40q..., want the text of the page first", got)
+			}
+		})
+	}
+}
+
+// FuzzExtractText checks that any input is read without panicking, in
+// bounded time
+func FuzzExtractText(f *testing.F) {
+	f.Add(onePage("", "BT /F1 12 Tf 72 720 Td (Hello) Tj 0 -14 Td [(a) -600 (b)] TJ ET"))
+	f.Add(onePage("/Font << /F2 6 0 R >>", "BT /F2 12 Tf <00010002> Tj ET",
+		"<< /Type /Font /Subtype /Type0 /Encoding /Identity-H /DescendantFonts [8 0 R] /ToUnicode 7 0 R >>",
+		streamObject("", toUnicode),
+		"<< /Type /Font /Subtype /CIDFontType2 /W [1 [500 600] 10 20 700] >>",
+	))
+	f.Add(buildPDF("<< /Root 1 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R >>",
+		flateStream("BT (compressed) Tj ET"),
+	))
+	f.Add(expandingForms(3, 4))
+	f.Add([]byte("%PDF-1.4\n1 0 obj << /Type /Catalog /Pages 1 0 R /Kids [1 0 R] >> endobj"))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		start := time.Now()
+		ExtractText(data)
+		if elapsed := time.Since(start); elapsed > 10*time.Second {
+			t.Fatalf("ExtractText() took %v on %d bytes", elapsed, len(data))
+		}
+	})
+}
@@ -0,0 +1,341 @@
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"strings"
+)
+
+// matrix is an affine transformation [a b c d e f]
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns the transformation applying m, then n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func translate(x, y float64) matrix {
+	return matrix{1, 0, 0, 1, x, y}
+}
+
+// graphicsState holds the parts of the graphics state that position text
+type graphicsState struct {
+	ctm       matrix
+	font      *font
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64 // Horizontal scaling, 1 is 100%
+	leading   float64
+}
+
+// maxFormDepth limits the nesting of form XObjects
+const maxFormDepth = 10
+
+// formCost is taken from the content budgets for every form drawn, on top of
+// its content, so that small forms drawn over and over run out of budget too
+const formCost = 1 << 10
+
+// textExtractor interprets content streams and lays out the text they show.
+// Text is written in the order it is shown; a new line starts when the
+// baseline moves by more than half the font size, and a space is added when
+// text is shown further right than where the previous text ended.
+type textExtractor struct {
+	doc    *document
+	fonts  map[ref]*font
+	state  graphicsState
+	stack  []graphicsState
+	tm     matrix           // Text matrix
+	tlm    matrix           // Text line matrix
+	forms  map[*stream]bool // Forms being run, which cannot draw themselves again
+	budget int              // Bytes of content left to interpret for the page, see maxPageContent
+
+	out      strings.Builder
+	hasText  bool
+	lastX    float64 // Where the previous glyph ended, in device space
+	lastY    float64
+	lastSize float64
+}
+
+func newTextExtractor(doc *document) *textExtractor {
+	return &textExtractor{
+		doc:    doc,
+		fonts:  make(map[ref]*font),
+		state:  graphicsState{ctm: identity, scale: 1},
+		forms:  make(map[*stream]bool),
+		budget: maxPageContent,
+	}
+}
+
+// text returns the text laid out so far
+func (t *textExtractor) text() string {
+	return strings.TrimRight(t.out.String(), " \n")
+}
+
+// run interprets a content stream with its resources. The content counts
+// against the budgets of the page and the document, and is cut short when
+// they run out.
+func (t *textExtractor) run(content []byte, resources dict, ctm matrix, depth int) {
+	content = content[:t.charge(len(content))]
+	t.state.ctm = ctm
+	l := &lexer{data: content}
+
+	var operands []interface{}
+	for {
+		tok, err := l.token()
+		if err != nil {
+			return
+		}
+		if tok == arrayStart || tok == dictStart {
+			if tok, err = l.complete(tok, 0); err != nil {
+				return
+			}
+		}
+		op, ok := tok.(keyword)
+		if !ok {
+			operands = append(operands, tok)
+			continue
+		}
+
+		t.operator(l, op, operands, resources, depth)
+		operands = operands[:0]
+	}
+}
+
+// operator runs the operator of a content stream on its operands
+func (t *textExtractor) operator(l *lexer, op keyword, operands []interface{}, resources dict, depth int) {
+	numbers := make([]float64, len(operands))
+	for i, operand := range operands {
+		numbers[i] = t.doc.number(operand, 0)
+	}
+	number := func(i int) float64 {
+		if i < len(numbers) {
+			return numbers[i]
+		}
+		return 0
+	}
+	text := func(i int) string {
+		if i < len(operands) {
+			s, _ := operands[i].(string)
+			return s
+		}
+		return ""
+	}
+
+	switch op {
+	case "q":
+		t.stack = append(t.stack, t.state)
+	case "Q":
+		if len(t.stack) > 0 {
+			t.state = t.stack[len(t.stack)-1]
+			t.stack = t.stack[:len(t.stack)-1]
+		}
+	case "cm":
+		if len(numbers) == 6 {
+			t.state.ctm = matrix(numbers).mul(t.state.ctm)
+		}
+
+	case "BT":
+		t.tm, t.tlm = identity, identity
+	case "Tf":
+		if len(operands) == 2 {
+			fontName, _ := operands[0].(name)
+			t.state.font = t.font(resources, fontName)
+			t.state.size = number(1)
+		}
+	case "Tc":
+		t.state.charSpace = number(0)
+	case "Tw":
+		t.state.wordSpace = number(0)
+	case "Tz":
+		t.state.scale = number(0) / 100
+	case "TL":
+		t.state.leading = number(0)
+	case "Td":
+		t.moveLine(number(0), number(1))
+	case "TD":
+		t.state.leading = -number(1)
+		t.moveLine(number(0), number(1))
+	case "Tm":
+		if len(numbers) == 6 {
+			t.tm, t.tlm = matrix(numbers), matrix(numbers)
+		}
+	case "T*":
+		t.moveLine(0, -t.state.leading)
+
+	case "Tj":
+		t.show(text(0))
+	case "'":
+		t.moveLine(0, -t.state.leading)
+		t.show(text(0))
+	case "\"":
+		t.state.wordSpace, t.state.charSpace = number(0), number(1)
+		t.moveLine(0, -t.state.leading)
+		t.show(text(2))
+	case "TJ":
+		if len(operands) == 0 {
+			return
+		}
+		items, _ := operands[len(operands)-1].(array)
+		for _, item := range items {
+			switch v := item.(type) {
+			case string:
+				t.show(v)
+			case int64, float64:
+				// Numbers move the next glyph left, in thousandths of text space
+				adjust := -t.doc.number(v, 0) / 1000 * t.state.size * t.state.scale
+				t.tm = translate(adjust, 0).mul(t.tm)
+			}
+		}
+
+	case "Do":
+		if len(operands) == 1 && depth < maxFormDepth {
+			xobjectName, _ := operands[0].(name)
+			t.form(resources, xobjectName, depth)
+		}
+	case "BI":
+		skipInlineImage(l)
+	}
+}
+
+// charge takes up to n bytes from the content budgets of the page and the
+// document, and returns how many were available
+func (t *textExtractor) charge(n int) int {
+	allowed := max(min(n, t.budget, t.doc.contentBudget), 0)
+	if allowed < n {
+		t.doc.truncated = true
+	}
+	t.budget -= allowed
+	t.doc.contentBudget -= allowed
+	return allowed
+}
+
+// moveLine starts a new line offset from the start of the current one
+func (t *textExtractor) moveLine(x, y float64) {
+	t.tlm = translate(x, y).mul(t.tlm)
+	t.tm = t.tlm
+}
+
+// show lays out the glyphs of a shown string and moves the text matrix past them
+func (t *textExtractor) show(s string) {
+	f := t.state.font
+	if f == nil {
+		f = &font{widths: map[int]float64{}, missing: defaultWidth, widthScale: 0.001, codeLength: 1, singleBytes: true, encoding: standardEncoding}
+		t.state.font = f
+	}
+
+	for _, g := range f.decode(s) {
+		trm := t.tm.mul(t.state.ctm)
+		size := t.state.size * math.Hypot(trm[2], trm[3])
+		if g.text != "" {
+			t.emit(g.text, trm[4], trm[5], size)
+		}
+
+		advance := g.width*t.state.size + t.state.charSpace
+		if g.wordSpace {
+			advance += t.state.wordSpace
+		}
+		t.tm = translate(advance*t.state.scale, 0).mul(t.tm)
+		end := t.tm.mul(t.state.ctm)
+		t.lastX, t.lastY = end[4], end[5]
+	}
+}
+
+// emit writes the text of a glyph shown at the position, starting a new line
+// or adding a space depending on where the previous glyph ended
+func (t *textExtractor) emit(text string, x, y, size float64) {
+	if t.hasText {
+		gap := x - t.lastX
+		switch {
+		case math.Abs(y-t.lastY) > math.Max(size, t.lastSize)/2:
+			t.out.WriteByte('\n')
+		case (gap > size*0.2 || gap < -size) && !strings.HasPrefix(text, " ") && !strings.HasSuffix(t.out.String(), " "):
+			t.out.WriteByte(' ')
+		}
+	}
+	t.out.WriteString(text)
+	t.hasText = true
+	t.lastSize = size
+}
+
+// font returns the font of the resources with the given name
+func (t *textExtractor) font(resources dict, fontName name) *font {
+	fontRef, isRef := t.doc.dict(resources["Font"])[fontName].(ref)
+	if isRef {
+		if f, ok := t.fonts[fontRef]; ok {
+			return f
+		}
+	}
+
+	d := t.doc.dict(t.doc.dict(resources["Font"])[fontName])
+	if d == nil {
+		return nil
+	}
+	f := t.doc.loadFont(d)
+	if isRef {
+		t.fonts[fontRef] = f
+	}
+	return f
+}
+
+// form interprets the content of a form XObject, which may show text. A form
+// drawing itself, directly or through other forms, is not run again.
+func (t *textExtractor) form(resources dict, xobjectName name, depth int) {
+	s, ok := t.doc.resolve(t.doc.dict(resources["XObject"])[xobjectName]).(*stream)
+	if !ok || t.doc.resolve(s.dict["Subtype"]) != name("Form") || t.forms[s] {
+		return
+	}
+	if t.charge(formCost) < formCost {
+		return
+	}
+	t.forms[s] = true
+	defer delete(t.forms, s)
+	content, err := t.doc.decode(s)
+	if err != nil {
+		return
+	}
+
+	formMatrix := identity
+	if m, ok := t.doc.resolve(s.dict["Matrix"]).(array); ok && len(m) == 6 {
+		for i := range m {
+			formMatrix[i] = t.doc.number(m[i], 0)
+		}
+	}
+	formResources := t.doc.dict(s.dict["Resources"])
+	if formResources == nil {
+		formResources = resources
+	}
+
+	// A form runs with a copy of the graphics state, like between q and Q
+	saved, savedStack, tm, tlm := t.state, t.stack, t.tm, t.tlm
+	t.stack = nil
+	t.run(content, formResources, formMatrix.mul(t.state.ctm), depth+1)
+	t.state, t.stack, t.tm, t.tlm = saved, savedStack, tm, tlm
+}
+
+// skipInlineImage moves the lexer past the data of an inline image, which
+// ends with EI surrounded by whitespace
+func skipInlineImage(l *lexer) {
+	start := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if start < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	for pos := l.pos + start + 2; pos+2 <= len(l.data); pos++ {
+		if l.data[pos] == 'E' && l.data[pos+1] == 'I' && isWhitespace(l.data[pos-1]) &&
+			(pos+2 == len(l.data) || isWhitespace(l.data[pos+2])) {
+			l.pos = pos + 2
+			return
+		}
+	}
+	l.pos = len(l.data)
+}
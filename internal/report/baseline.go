@@ -0,0 +1,107 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// BaselineVersion is the version of the baseline file format
+const BaselineVersion = 1
+
+// Baseline lists the fingerprints of accepted findings. Scans given a
+// baseline only report the findings that are not part of it.
+type Baseline struct {
+	Version  int             `json:"version"`
+	Findings []BaselineEntry `json:"findings"`
+}
+
+// BaselineEntry identifies an accepted finding. The secret is only stored as
+// a hash so the baseline can be committed without leaking it again.
+type BaselineEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	RuleID      string `json:"ruleId"`
+	File        string `json:"file"`
+	SecretHash  string `json:"secretHash"`
+	Commit      string `json:"commit,omitempty"`
+}
+
+// Fingerprint identifies a finding by its rule, file, secret and commit, so it
+// stays the same when lines are added above the secret
+func Fingerprint(finding Finding) string {
+	return newBaselineEntry(finding).Fingerprint
+}
+
+func newBaselineEntry(finding Finding) BaselineEntry {
+	sum := sha256.Sum256([]byte(finding.Secret))
+	entry := BaselineEntry{
+		RuleID:     finding.RuleID,
+		File:       finding.File,
+		SecretHash: hex.EncodeToString(sum[:]),
+		Commit:     finding.Commit,
+	}
+	entry.Fingerprint = fmt.Sprintf("%s:%s:%s:%s", entry.RuleID, entry.File, entry.SecretHash, entry.Commit)
+	return entry
+}
+
+// LoadBaseline reads a baseline file written with the baseline format
+func LoadBaseline(path string) (*Baseline, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read baseline: %w", err)
+	}
+
+	var baseline Baseline
+	if err := json.Unmarshal(data, &baseline); err != nil {
+		return nil, fmt.Errorf("invalid baseline %s: %w", path, err)
+	}
+	if baseline.Version != BaselineVersion {
+		return nil, fmt.Errorf("unsupported baseline version %d in %s", baseline.Version, path)
+	}
+	return &baseline, nil
+}
+
+// Filter removes the findings of the report that are part of the baseline and
+// counts them in the summary
+func (b *Baseline) Filter(r *Report) {
+	accepted := make(map[string]bool, len(b.Findings))
+	for _, entry := range b.Findings {
+		accepted[entry.Fingerprint] = true
+	}
+
+	findings := []Finding{}
+	for _, finding := range r.Findings {
+		if accepted[Fingerprint(finding)] {
+			r.Summary.Baselined++
+			continue
+		}
+		findings = append(findings, finding)
+	}
+	r.Findings = findings
+}
+
+// writeBaseline renders the findings as a baseline file, sorted and without
+// duplicates so it diffs well when it is regenerated
+func writeBaseline(w io.Writer, r *Report) error {
+	baseline := Baseline{Version: BaselineVersion, Findings: []BaselineEntry{}}
+	seen := make(map[string]bool)
+	for _, finding := range r.Findings {
+		entry := newBaselineEntry(finding)
+		if seen[entry.Fingerprint] {
+			continue
+		}
+		seen[entry.Fingerprint] = true
+		baseline.Findings = append(baseline.Findings, entry)
+	}
+	sort.Slice(baseline.Findings, func(i, j int) bool {
+		return baseline.Findings[i].Fingerprint < baseline.Findings[j].Fingerprint
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(baseline)
+}
@@ -0,0 +1,65 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// gitleaksFinding mirrors the finding schema of gitleaks JSON reports so that
+// tooling built around gitleaks can consume docser results unchanged.
+type gitleaksFinding struct {
+	Description string
+	StartLine   int
+	EndLine     int
+	StartColumn int
+	EndColumn   int
+	Match       string
+	Secret      string
+	File        string
+	SymlinkFile string
+	Commit      string
+	Entropy     float32
+	Author      string
+	Email       string
+	Date        string
+	Message     string
+	Tags        []string
+	RuleID      string
+	Fingerprint string
+}
+
+// writeGitleaks renders the findings as a gitleaks JSON report
+func writeGitleaks(w io.Writer, r *Report) error {
+	findings := []gitleaksFinding{}
+	for _, finding := range r.Findings {
+		fingerprint := fmt.Sprintf("%s:%s:%d", finding.File, finding.RuleID, finding.Line)
+		if finding.Commit != "" {
+			fingerprint = finding.Commit + ":" + fingerprint
+		}
+
+		findings = append(findings, gitleaksFinding{
+			Description: finding.Rule,
+			StartLine:   finding.Line,
+			EndLine:     finding.EndLine,
+			StartColumn: finding.StartColumn,
+			EndColumn:   finding.EndColumn,
+			Match:       finding.Match,
+			Secret:      finding.Secret,
+			File:        finding.File,
+			Commit:      finding.Commit,
+			Entropy:     float32(finding.Entropy),
+			Author:      finding.Author,
+			Email:       finding.Email,
+			Date:        finding.Date,
+			Message:     finding.Message,
+			Tags:        append([]string{}, finding.Tags...),
+			RuleID:      finding.RuleID,
+			Fingerprint: fingerprint,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", " ")
+	return encoder.Encode(findings)
+}
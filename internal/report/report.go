@@ -0,0 +1,227 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SchemaVersion is the version of the JSON report document. It must be bumped
+// whenever a field is renamed or removed so downstream consumers can detect it.
+const SchemaVersion = "1.0.0"
+
+// Finding represents a single secret detected by a scan
+type Finding struct {
+	RuleID      string   `json:"ruleId"`
+	Rule        string   `json:"rule"`
+	Severity    string   `json:"severity"`
+	Confidence  string   `json:"confidence"`
+	Tags        []string `json:"tags,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+	Entropy     float64  `json:"entropy"`
+	Placeholder string   `json:"placeholder,omitempty"`
+	Context     string   `json:"context,omitempty"`
+	Language    string   `json:"language,omitempty"`
+	File        string   `json:"file"`
+	Page        int      `json:"page,omitempty"`
+	Line        int      `json:"line"`
+	EndLine     int      `json:"endLine"`
+	StartColumn int      `json:"startColumn"`
+	EndColumn   int      `json:"endColumn"`
+	Commit      string   `json:"commit,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	Email       string   `json:"email,omitempty"`
+	Date        string   `json:"date,omitempty"`
+	Message     string   `json:"message,omitempty"`
+	Match       string   `json:"match"`
+	Secret      string   `json:"secret"`
+	SecretStart int      `json:"secretStartColumn"`
+	SecretEnd   int      `json:"secretEndColumn"`
+}
+
+// Rule describes a pattern that was active during the scan
+type Rule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description"`
+	Severity    string   `json:"severity"`
+	Confidence  string   `json:"confidence"`
+	Tags        []string `json:"tags,omitempty"`
+	Remediation string   `json:"remediation,omitempty"`
+}
+
+// Summary holds the counters and timestamps of a scan
+type Summary struct {
+	Target         string    `json:"target"`
+	StartedAt      time.Time `json:"startedAt"`
+	FinishedAt     time.Time `json:"finishedAt"`
+	DurationMillis int64     `json:"durationMillis"`
+	CommitsScanned int       `json:"commitsScanned"`
+	FilesScanned   int       `json:"filesScanned"`
+	Findings       int       `json:"findings"`
+	Suppressed     int       `json:"suppressed"`
+	Baselined      int       `json:"baselined"`
+}
+
+// Tool identifies the docser build that produced a report
+type Tool struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Report is the document written by every report format
+type Report struct {
+	SchemaVersion string    `json:"schemaVersion"`
+	Tool          Tool      `json:"tool"`
+	Summary       Summary   `json:"summary"`
+	Rules         []Rule    `json:"-"`
+	Findings      []Finding `json:"findings"`
+	// Suppressed holds the findings marked as intended by a docser:allow
+	// comment. It is only filled when they are requested.
+	Suppressed []Finding `json:"suppressed,omitempty"`
+	// Baseline holds the accepted findings left out of the report by Finish
+	Baseline *Baseline `json:"-"`
+}
+
+// writers maps every supported format name to the function that renders it
+var writers = map[string]func(io.Writer, *Report) error{
+	"text":     writeText,
+	"json":     writeJSON,
+	"sarif":    writeSARIF,
+	"gitleaks": writeGitleaks,
+	"baseline": writeBaseline,
+}
+
+// New creates an empty report for the given target and marks the scan as started
+func New(version string, target string) *Report {
+	return &Report{
+		SchemaVersion: SchemaVersion,
+		Tool:          Tool{Name: "docser", Version: version},
+		Summary:       Summary{Target: target, StartedAt: time.Now().UTC()},
+		Findings:      []Finding{},
+	}
+}
+
+// Finish marks the scan as completed, leaves out the findings of the baseline
+// and updates the summary counters
+func (r *Report) Finish() {
+	if r.Baseline != nil {
+		r.Baseline.Filter(r)
+	}
+	r.Summary.FinishedAt = time.Now().UTC()
+	r.Summary.DurationMillis = r.Summary.FinishedAt.Sub(r.Summary.StartedAt).Milliseconds()
+	r.Summary.Findings = len(r.Findings)
+}
+
+// Formats returns the names of all supported report formats
+func Formats() []string {
+	var formats []string
+	for format := range writers {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// IsSupported reports whether the given format has a writer
+func IsSupported(format string) bool {
+	_, ok := writers[format]
+	return ok
+}
+
+// Write renders the report in the given format to w
+func Write(w io.Writer, format string, r *Report) error {
+	writer, ok := writers[format]
+	if !ok {
+		return fmt.Errorf("unsupported report format %q (supported: %v)", format, Formats())
+	}
+	return writer(w, r)
+}
+
+// WriteFile renders the report to the given path, or to stdout when the path is empty
+func WriteFile(path string, format string, r *Report) error {
+	if path == "" {
+		return Write(os.Stdout, format, r)
+	}
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("unable to create report file: %w", err)
+	}
+	defer file.Close()
+
+	if err := Write(file, format, r); err != nil {
+		return err
+	}
+	return file.Sync()
+}
+
+func writeJSON(w io.Writer, r *Report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+func writeText(w io.Writer, r *Report) error {
+	writeTextFindings(w, r.Findings)
+	if len(r.Suppressed) > 0 {
+		fmt.Fprintln(w, "\nSuppressed by docser:allow comments:")
+		writeTextFindings(w, r.Suppressed)
+	}
+
+	suppressed := ""
+	if r.Summary.Suppressed > 0 {
+		suppressed = fmt.Sprintf(", %d suppressed", r.Summary.Suppressed)
+	}
+	if r.Summary.Baselined > 0 {
+		suppressed += fmt.Sprintf(", %d in baseline", r.Summary.Baselined)
+	}
+	if r.Summary.CommitsScanned == 0 {
+		fmt.Fprintf(w, "\n[+] Scanned %d files in %dms, %d findings%s.\n",
+			r.Summary.FilesScanned, r.Summary.DurationMillis, r.Summary.Findings, suppressed)
+		return nil
+	}
+	fmt.Fprintf(w, "\n[+] Scanned %d commits and %d files in %dms, %d findings%s.\n",
+		r.Summary.CommitsScanned, r.Summary.FilesScanned, r.Summary.DurationMillis, r.Summary.Findings, suppressed)
+	return nil
+}
+
+// writeTextFindings prints the findings grouped by commit and file
+func writeTextFindings(w io.Writer, findings []Finding) {
+	lastCommit, lastFile := "", ""
+	for _, finding := range findings {
+		if finding.Commit != lastCommit || finding.File != lastFile {
+			if finding.Commit != "" {
+				fmt.Fprintln(w, "Hash:", finding.Commit)
+			}
+			fmt.Fprintln(w, "File:", finding.File)
+			lastCommit, lastFile = finding.Commit, finding.File
+		}
+		lines := fmt.Sprintf("Line %d", finding.Line)
+		if finding.EndLine > finding.Line {
+			lines = fmt.Sprintf("Lines %d-%d", finding.Line, finding.EndLine)
+		}
+		if finding.Page > 0 {
+			lines = fmt.Sprintf("Page %d, %s", finding.Page, lines)
+		}
+		// Only the first line of a multi-line match is printed
+		match := finding.Match
+		if i := strings.IndexByte(match, '\n'); i >= 0 {
+			match = strings.TrimSuffix(match[:i], "\r") + " ..."
+		}
+		if finding.Context != "" && finding.Context != "text" {
+			context := finding.Context
+			if finding.Language != "" {
+				context += ":" + finding.Language
+			}
+			match += " (context: " + context + ")"
+		}
+		if finding.Placeholder != "" {
+			match += " (placeholder: " + finding.Placeholder + ")"
+		}
+		fmt.Fprintf(w, "  %s: [%s] %s: %s\n", lines, finding.Severity, finding.Rule, match)
+	}
+}
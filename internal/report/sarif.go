@@ -0,0 +1,244 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	docserURI    = "https://github.com/thecyberworld/docser"
+)
+
+// The types below only model the subset of SARIF 2.1.0 that docser produces.
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool       sarifTool     `json:"tool"`
+	ColumnKind string        `json:"columnKind"`
+	Results    []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name            string                     `json:"name"`
+	SemanticVersion string                     `json:"semanticVersion"`
+	InformationURI  string                     `json:"informationUri"`
+	Rules           []sarifReportingDescriptor `json:"rules"`
+}
+
+type sarifReportingDescriptor struct {
+	ID                   string              `json:"id"`
+	Name                 string              `json:"name"`
+	ShortDescription     sarifMessage        `json:"shortDescription"`
+	Help                 *sarifMessage       `json:"help,omitempty"`
+	DefaultConfiguration sarifConfiguration  `json:"defaultConfiguration"`
+	Properties           sarifRuleProperties `json:"properties"`
+}
+
+type sarifConfiguration struct {
+	Level string `json:"level"`
+}
+
+// sarifRuleProperties holds the rule metadata understood by code scanning
+// tools: tags, precision and a numeric security severity
+type sarifRuleProperties struct {
+	Tags             []string `json:"tags,omitempty"`
+	Precision        string   `json:"precision,omitempty"`
+	SecuritySeverity string   `json:"security-severity,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID              string                `json:"ruleId"`
+	RuleIndex           int                   `json:"ruleIndex"`
+	Level               string                `json:"level"`
+	Message             sarifMessage          `json:"message"`
+	Locations           []sarifLocation       `json:"locations"`
+	PartialFingerprints map[string]string     `json:"partialFingerprints,omitempty"`
+	Properties          sarifResultProperties `json:"properties"`
+	Suppressions        []sarifSuppression    `json:"suppressions,omitempty"`
+}
+
+type sarifSuppression struct {
+	Kind          string `json:"kind"`
+	Justification string `json:"justification,omitempty"`
+}
+
+type sarifResultProperties struct {
+	Entropy     float64 `json:"entropy"`
+	Page        int     `json:"page,omitempty"`
+	Placeholder string  `json:"placeholder,omitempty"`
+	Context     string  `json:"context,omitempty"`
+	Language    string  `json:"language,omitempty"`
+	// Metadata of the commit that introduced the secret
+	Author        string `json:"author,omitempty"`
+	Email         string `json:"email,omitempty"`
+	Date          string `json:"date,omitempty"`
+	CommitMessage string `json:"commitMessage,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int          `json:"startLine"`
+	EndLine     int          `json:"endLine,omitempty"`
+	StartColumn int          `json:"startColumn,omitempty"`
+	EndColumn   int          `json:"endColumn,omitempty"`
+	Snippet     sarifMessage `json:"snippet"`
+}
+
+// sarifSecuritySeverity maps the docser severities to the CVSS-like scores
+// code scanning tools use to rank security results
+var sarifSecuritySeverity = map[string]string{
+	"info":     "0.0",
+	"low":      "3.0",
+	"medium":   "5.0",
+	"high":     "8.0",
+	"critical": "9.5",
+}
+
+// sarifLevel maps a docser severity to a SARIF result level. Findings without
+// a severity keep being reported as errors.
+func sarifLevel(severity string) string {
+	switch severity {
+	case "info", "low":
+		return "note"
+	case "medium":
+		return "warning"
+	default:
+		return "error"
+	}
+}
+
+// writeSARIF renders the report as a SARIF 2.1.0 log with a single run
+func writeSARIF(w io.Writer, r *Report) error {
+	ruleIndex := make(map[string]int)
+	rules := []sarifReportingDescriptor{}
+	addRule := func(rule Rule) {
+		if _, ok := ruleIndex[rule.ID]; ok {
+			return
+		}
+		descriptor := sarifReportingDescriptor{
+			ID:                   rule.ID,
+			Name:                 rule.Description,
+			ShortDescription:     sarifMessage{Text: rule.Description},
+			DefaultConfiguration: sarifConfiguration{Level: sarifLevel(rule.Severity)},
+			Properties: sarifRuleProperties{
+				Tags:             rule.Tags,
+				Precision:        rule.Confidence,
+				SecuritySeverity: sarifSecuritySeverity[rule.Severity],
+			},
+		}
+		if rule.Remediation != "" {
+			descriptor.Help = &sarifMessage{Text: rule.Remediation}
+		}
+		ruleIndex[rule.ID] = len(rules)
+		rules = append(rules, descriptor)
+	}
+	for _, rule := range r.Rules {
+		addRule(rule)
+	}
+
+	results := []sarifResult{}
+	addResult := func(finding Finding, suppressed bool) {
+		// Findings may come from rules that were not registered on the report
+		addRule(Rule{
+			ID:          finding.RuleID,
+			Description: finding.Rule,
+			Severity:    finding.Severity,
+			Confidence:  finding.Confidence,
+			Tags:        finding.Tags,
+			Remediation: finding.Remediation,
+		})
+
+		result := sarifResult{
+			RuleID:    finding.RuleID,
+			RuleIndex: ruleIndex[finding.RuleID],
+			Level:     sarifLevel(finding.Severity),
+			Message:   sarifMessage{Text: fmt.Sprintf("%s has detected a secret in %s", finding.Rule, finding.File)},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: finding.File},
+					Region: sarifRegion{
+						StartLine:   finding.Line,
+						EndLine:     finding.EndLine,
+						StartColumn: finding.StartColumn,
+						EndColumn:   finding.EndColumn + 1, // SARIF end columns are exclusive
+						Snippet:     sarifMessage{Text: finding.Match},
+					},
+				},
+			}},
+			Properties: sarifResultProperties{
+				Entropy:     finding.Entropy,
+				Page:        finding.Page,
+				Placeholder: finding.Placeholder,
+				Context:     finding.Context,
+				Language:    finding.Language,
+
+				Author:        finding.Author,
+				Email:         finding.Email,
+				Date:          finding.Date,
+				CommitMessage: finding.Message,
+			},
+		}
+		if finding.Commit != "" {
+			// Only the commit identifies the result, the rest is metadata
+			result.PartialFingerprints = map[string]string{"commitSha": finding.Commit}
+		}
+		if suppressed {
+			result.Suppressions = []sarifSuppression{{Kind: "inSource", Justification: "docser:allow comment"}}
+		}
+		results = append(results, result)
+	}
+	for _, finding := range r.Findings {
+		addResult(finding, false)
+	}
+	for _, finding := range r.Suppressed {
+		addResult(finding, true)
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:            r.Tool.Name,
+				SemanticVersion: strings.TrimPrefix(r.Tool.Version, "v"),
+				InformationURI:  docserURI,
+				Rules:           rules,
+			}},
+			ColumnKind: "unicodeCodePoints",
+			Results:    results,
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
@@ -0,0 +1,105 @@
+package scanner
+
+import (
+	"docser/internal/scanner/scan_engine"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// ignoreFileName is the name of the ignore file read at the root of a scan
+const ignoreFileName = ".docserignore"
+
+// loadIgnore builds the matcher of the .docserignore at the root of the scanned
+// repository or directory, followed by the patterns of opts.IgnoreFile, which
+// take precedence. It returns nil when there are no patterns.
+func loadIgnore(opts Options, repo *git.Repository) (gitignore.Matcher, error) {
+	ps, err := readRootIgnore(opts, repo)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", ignoreFileName, err)
+	}
+
+	if opts.IgnoreFile != "" {
+		f, err := os.Open(opts.IgnoreFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ignore file: %w", err)
+		}
+		defer f.Close()
+
+		filePatterns, err := scan_engine.ParseIgnorePatterns(f)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read ignore file: %w", err)
+		}
+		ps = append(ps, filePatterns...)
+	}
+
+	if len(ps) == 0 {
+		return nil, nil
+	}
+	return gitignore.NewMatcher(ps), nil
+}
+
+// readRootIgnore reads the patterns of the .docserignore at the root of the
+// scan, if there is one. Directories and worktrees are read from disk, while
+// repositories without a worktree, like remote clones, are read from HEAD.
+func readRootIgnore(opts Options, repo *git.Repository) ([]gitignore.Pattern, error) {
+	var r io.ReadCloser
+	if repo == nil {
+		f, err := os.Open(filepath.Join(opts.RepositoryPath, ignoreFileName))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	} else if worktree, err := repo.Worktree(); err == nil {
+		f, err := worktree.Filesystem.Open(ignoreFileName)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		r = f
+	} else if err == git.ErrIsBareRepository {
+		f, err := headFile(repo, ignoreFileName)
+		if f == nil || err != nil {
+			return nil, err
+		}
+		if r, err = f.Reader(); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, err
+	}
+	defer r.Close()
+
+	log.Printf("[+] Using ignore file %s\n", ignoreFileName)
+	return scan_engine.ParseIgnorePatterns(r)
+}
+
+// headFile returns the file at the path in the HEAD commit, or nil when the
+// repository has no commits or HEAD has no such file
+func headFile(repo *git.Repository, path string) (*object.File, error) {
+	head, err := repo.Head()
+	if err != nil {
+		return nil, nil
+	}
+	commit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	f, err := commit.File(path)
+	if err == object.ErrFileNotFound {
+		return nil, nil
+	}
+	return f, err
+}
@@ -0,0 +1,107 @@
+package scan_engine
+
+import (
+	"strings"
+	"sync"
+
+	"docser/internal/patterns"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// blobCache remembers the pattern matches of every blob scanned during a run,
+// and the text of every PDF document extracted. Git stores identical contents
+// once under the same hash, so a blob that shows up again on another branch,
+// under another name or after a revert is only matched the first time. Blobs
+// are cached along with the name key of the ruleset, since Markdown contexts
+// and path restrictions make the matches depend on the file name. It is safe
+// for concurrent use; workers asking for a blob that is still being scanned
+// wait for the first scan to finish.
+type blobCache struct {
+	mu      sync.Mutex
+	entries map[blobKey]*cachedBlob
+	texts   map[plumbing.Hash]*cachedText
+}
+
+type blobKey struct {
+	hash    plumbing.Hash
+	nameKey string
+}
+
+type cachedBlob struct {
+	done    chan struct{}
+	matches []patterns.MatchResult
+	err     error
+}
+
+// cachedText is the text of the pages of a PDF document, see readContents
+type cachedText struct {
+	done       chan struct{}
+	text       string
+	pageStarts []int
+	ok         bool
+}
+
+func newBlobCache() *blobCache {
+	return &blobCache{
+		entries: make(map[blobKey]*cachedBlob),
+		texts:   make(map[plumbing.Hash]*cachedText),
+	}
+}
+
+// text returns the text of the pages of a PDF document and the line each page
+// starts on, extracting it from the raw contents only when the blob has not
+// been seen before. Extraction is the costly part of scanning a document and
+// the text does not depend on the file name, so blobs are cached by hash.
+func (c *blobCache) text(file *object.File, contents string) (string, []int, bool) {
+	c.mu.Lock()
+	entry, ok := c.texts[file.Hash]
+	if !ok {
+		entry = &cachedText{done: make(chan struct{})}
+		c.texts[file.Hash] = entry
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-entry.done
+	} else {
+		entry.text, entry.pageStarts, entry.ok = readContents(file.Name, []byte(contents))
+		close(entry.done)
+	}
+	return entry.text, entry.pageStarts, entry.ok
+}
+
+// scan returns the matches of the changed file, pattern-matching its blob only
+// when it has not been seen under an equivalent name before. The returned
+// matches carry the name of the given file, whichever path the blob was first
+// scanned under. The scanned result reports whether the blob was actually
+// matched by this call.
+func (c *blobCache) scan(change *fileChange, rs *patterns.Ruleset) (matches []patterns.MatchResult, scanned bool, err error) {
+	key := blobKey{hash: change.File.Hash, nameKey: rs.NameKey(change.File.Name)}
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	if !ok {
+		entry = &cachedBlob{done: make(chan struct{})}
+		c.entries[key] = entry
+	}
+	c.mu.Unlock()
+
+	if ok {
+		<-entry.done
+	} else {
+		entry.matches, entry.err = patterns.ProcessTextContentsWithRegex(change.File.Name, strings.NewReader(change.Contents), rs)
+		close(entry.done)
+		scanned = true
+	}
+	if entry.err != nil {
+		return nil, scanned, entry.err
+	}
+
+	matches = make([]patterns.MatchResult, len(entry.matches))
+	for i, match := range entry.matches {
+		match.FileName = change.File.Name
+		matches[i] = match
+	}
+	return matches, scanned, nil
+}
@@ -0,0 +1,220 @@
+package scan_engine
+
+import (
+	"strings"
+
+	"docser/internal/report"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/utils/diff"
+
+	"github.com/sergi/go-diff/diffmatchpatch"
+)
+
+// fileChange is a file added or modified by a commit
+type fileChange struct {
+	File *object.File
+	// From is the version of the file in the first parent, nil when the file is new
+	From *object.File
+	// Kind tells how both versions of the file are scanned
+	Kind fileKind
+	// Contents and FromContents are loaded from the repository before the change
+	// is handed over to a worker, so workers never touch the object storage. The
+	// raw contents of PDF documents are replaced by their text on the worker,
+	// see extractText.
+	Contents     string
+	FromContents string
+	// AddedLines holds the 1-based line numbers introduced by the commit.
+	// A nil map means the whole file is new.
+	AddedLines map[int]bool
+	// PageStarts holds the line of Contents each page of a PDF document starts
+	// on, nil for other files
+	PageStarts []int
+}
+
+// includes reports whether any line from first to last was introduced by the
+// change, so a multi-line match is reported when only part of it changed
+func (c fileChange) includes(first int, last int) bool {
+	if c.AddedLines == nil {
+		return true
+	}
+	for lineNumber := first; lineNumber <= last; lineNumber++ {
+		if c.AddedLines[lineNumber] {
+			return true
+		}
+	}
+	return false
+}
+
+// commitChanges returns the files added or modified by the commit compared to
+// its first parent. Root commits introduce every file of their tree. For merge
+// commits, files whose content is identical to one of the other parents are
+// skipped because they were introduced, and scanned, on that parent's side.
+func commitChanges(commitObj *object.Commit) ([]fileChange, error) {
+	tree, err := commitObj.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	var parentTrees []*object.Tree
+	err = commitObj.Parents().ForEach(func(parent *object.Commit) error {
+		parentTree, err := parent.Tree()
+		if err != nil {
+			return err
+		}
+		parentTrees = append(parentTrees, parentTree)
+		return nil
+	})
+	// The parents of the oldest commits of a shallow clone are not available,
+	// those commits are scanned like root commits
+	if err == plumbing.ErrObjectNotFound {
+		parentTrees, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(parentTrees) == 0 {
+		var changes []fileChange
+		err := tree.Files().ForEach(func(file *object.File) error {
+			changes = append(changes, fileChange{File: file})
+			return nil
+		})
+		return changes, err
+	}
+
+	treeChanges, err := object.DiffTree(parentTrees[0], tree)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []fileChange
+	for _, treeChange := range treeChanges {
+		from, to, err := treeChange.Files()
+		if err != nil {
+			return nil, err
+		}
+		// Deleted files do not introduce anything
+		if to == nil || inOtherParent(to, parentTrees[1:]) {
+			continue
+		}
+
+		changes = append(changes, fileChange{File: to, From: from})
+	}
+	return changes, nil
+}
+
+// inOtherParent reports whether one of the trees holds the exact same blob at the same path
+func inOtherParent(file *object.File, trees []*object.Tree) bool {
+	for _, tree := range trees {
+		entry, err := tree.FindEntry(file.Name)
+		if err == nil && entry.Hash == file.Hash {
+			return true
+		}
+	}
+	return false
+}
+
+// loadContents reads both versions of a text file or PDF document from the
+// repository. It returns false for binary files, which are not scanned. A file
+// replacing one of another kind is treated as a new file.
+func (c *fileChange) loadContents() (bool, error) {
+	// Check if the file type corresponds to text-based formats or PDF documents
+	c.Kind = fileKindOf(c.File)
+	if c.Kind == binaryFile {
+		return false, nil
+	}
+
+	var err error
+	c.Contents, err = c.File.Contents()
+	if err != nil {
+		return false, err
+	}
+
+	if c.From != nil && fileKindOf(c.From) != c.Kind {
+		c.From = nil
+	}
+	if c.From != nil {
+		c.FromContents, err = c.From.Contents()
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// extractText replaces the raw contents of both versions of a PDF document by
+// the text of their pages, each blob being extracted once per scan. It returns
+// false when the text of the document cannot be read. A document whose
+// previous version cannot be read is treated as a new file.
+func (c *fileChange) extractText(cache *blobCache) bool {
+	if c.Kind != pdfFile {
+		return true
+	}
+
+	var ok bool
+	c.Contents, c.PageStarts, ok = cache.text(c.File, c.Contents)
+	if !ok {
+		return false
+	}
+	if c.From != nil {
+		c.FromContents, _, ok = cache.text(c.From, c.FromContents)
+		if !ok {
+			c.From, c.FromContents = nil, ""
+		}
+	}
+	return true
+}
+
+// locate turns the line numbers of a finding in the text of a PDF document
+// into a page number and line numbers within that page
+func (c fileChange) locate(finding *report.Finding) {
+	for page := len(c.PageStarts) - 1; page >= 0; page-- {
+		if start := c.PageStarts[page]; finding.Line >= start {
+			finding.Page = page + 1
+			finding.Line -= start - 1
+			finding.EndLine -= start - 1
+			return
+		}
+	}
+}
+
+// addedLines runs a line diff between both versions of a file and returns the
+// line numbers of the new version that do not exist in the old one. Both
+// versions are compared as if they ended with a newline, so appending to a
+// file without one does not mark its last line as added.
+func addedLines(fromContents, toContents string) map[int]bool {
+	added := make(map[int]bool)
+	lineNumber := 0
+	for _, d := range diff.Do(withFinalNewline(fromContents), withFinalNewline(toContents)) {
+		lines := countLines(d.Text)
+		switch d.Type {
+		case diffmatchpatch.DiffEqual:
+			lineNumber += lines
+		case diffmatchpatch.DiffInsert:
+			for i := 1; i <= lines; i++ {
+				added[lineNumber+i] = true
+			}
+			lineNumber += lines
+		}
+	}
+	return added
+}
+
+// withFinalNewline terminates the last line of a non-empty text
+func withFinalNewline(text string) string {
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		return text + "\n"
+	}
+	return text
+}
+
+// countLines returns the number of lines in a chunk of a line diff
+func countLines(text string) int {
+	lines := strings.Count(text, "\n")
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		lines++
+	}
+	return lines
+}
@@ -0,0 +1,222 @@
+package scan_engine
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/src-d/go-billy.v4/memfs"
+	"gopkg.in/src-d/go-billy.v4/util"
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+func TestAddedLines(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want []int
+	}{
+		{name: "modified line", from: "a\nb\nc\n", to: "a\nX\nc\n", want: []int{2}},
+		{name: "inserted lines", from: "a\nc\n", to: "a\nb1\nb2\nc\n", want: []int{2, 3}},
+		{name: "appended line", from: "a\nb\n", to: "a\nb\nc\n", want: []int{3}},
+		{name: "appended after a last line without newline", from: "a\nb", to: "a\nb\nc", want: []int{3}},
+		{name: "modified last line without newline", from: "a\nb", to: "a\nX", want: []int{2}},
+		{name: "newline added to the last line", from: "a\nb", to: "a\nb\n", want: nil},
+		{name: "empty old version", from: "", to: "a\nb", want: []int{1, 2}},
+		{name: "deleted line", from: "a\nb\nc\n", to: "a\nc\n", want: nil},
+		{name: "identical", from: "a\nb\n", to: "a\nb\n", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []int
+			for lineNumber := range addedLines(tt.from, tt.to) {
+				got = append(got, lineNumber)
+			}
+			sort.Ints(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("addedLines(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// testRepo builds commits with explicit parents in an in-memory repository
+type testRepo struct {
+	t        *testing.T
+	repo     *git.Repository
+	worktree *git.Worktree
+	when     time.Time
+}
+
+func newTestRepo(t *testing.T) *testRepo {
+	t.Helper()
+	repo, err := git.Init(memory.NewStorage(), memfs.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testRepo{t: t, repo: repo, worktree: worktree, when: time.Unix(1600000000, 0)}
+}
+
+// commit records a commit whose tree holds exactly files on top of parents
+func (r *testRepo) commit(files map[string]string, parents ...plumbing.Hash) plumbing.Hash {
+	r.t.Helper()
+	existing, err := r.worktree.Filesystem.ReadDir("/")
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	for _, info := range existing {
+		if info.Name() == ".git" {
+			continue
+		}
+		if err := util.RemoveAll(r.worktree.Filesystem, info.Name()); err != nil {
+			r.t.Fatal(err)
+		}
+		if _, err := r.worktree.Remove(info.Name()); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+	for name, contents := range files {
+		if err := util.WriteFile(r.worktree.Filesystem, name, []byte(contents), 0644); err != nil {
+			r.t.Fatal(err)
+		}
+		if _, err := r.worktree.Add(name); err != nil {
+			r.t.Fatal(err)
+		}
+	}
+
+	// Distinct dates keep the hashes of commits with the same tree apart
+	r.when = r.when.Add(time.Minute)
+	hash, err := r.worktree.Commit("commit", &git.CommitOptions{
+		Author:  &object.Signature{Name: "test", Email: "test@example.com", When: r.when},
+		Parents: parents,
+	})
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return hash
+}
+
+// changedFiles returns the new and old names of the files commitChanges
+// returns for the commit, keyed by new name, with an empty old name for new files
+func (r *testRepo) changedFiles(hash plumbing.Hash) map[string]string {
+	r.t.Helper()
+	commitObj, err := r.repo.CommitObject(hash)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	changes, err := commitChanges(commitObj)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	files := make(map[string]string)
+	for _, change := range changes {
+		files[change.File.Name] = ""
+		if change.From != nil {
+			files[change.File.Name] = change.From.Name
+		}
+	}
+	return files
+}
+
+func TestCommitChanges(t *testing.T) {
+	r := newTestRepo(t)
+
+	root := r.commit(map[string]string{"a.txt": "a\n", "b.txt": "b\n"})
+	if got, want := r.changedFiles(root), map[string]string{"a.txt": "", "b.txt": ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("root commit: got %v, want %v", got, want)
+	}
+
+	// Modifying a.txt, deleting b.txt and adding c.txt
+	main := r.commit(map[string]string{"a.txt": "a\nA\n", "c.txt": "c\n"}, root)
+	if got, want := r.changedFiles(main), map[string]string{"a.txt": "a.txt", "c.txt": ""}; !reflect.DeepEqual(got, want) {
+		t.Errorf("modifying commit: got %v, want %v", got, want)
+	}
+
+	side := r.commit(map[string]string{"a.txt": "a\n", "b.txt": "b\n", "d.txt": "d\n"}, root)
+
+	// The merge takes d.txt from the side branch as is and changes c.txt
+	merge := r.commit(map[string]string{"a.txt": "a\nA\n", "c.txt": "c\nC\n", "d.txt": "d\n"}, main, side)
+	if got, want := r.changedFiles(merge), map[string]string{"c.txt": "c.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("merge commit: got %v, want %v", got, want)
+	}
+}
+
+// onePagePDF is a document whose only page shows "token: xoxb-1", its objects
+// are found by scanning as it has no cross-reference table
+const onePagePDF = `%PDF-1.7
+1 0 obj
+<< /Type /Catalog /Pages 2 0 R >>
+endobj
+2 0 obj
+<< /Type /Pages /Kids [3 0 R] /Count 1 >>
+endobj
+3 0 obj
+<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>
+endobj
+4 0 obj
+<< /Length 44 >>
+stream
+BT /F1 12 Tf 72 720 Td (token: xoxb-1) Tj ET
+endstream
+endobj
+5 0 obj
+<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>
+endobj
+trailer
+<< /Root 1 0 R >>
+%%EOF
+`
+
+func TestExtractText(t *testing.T) {
+	cache := newBlobCache()
+
+	// The same blob under two names is extracted once
+	for _, name := range []string{"a.pdf", "docs/b.pdf"} {
+		change := fileChange{File: memoryFile(name, []byte(onePagePDF)), Kind: pdfFile, Contents: onePagePDF}
+		if !change.extractText(cache) {
+			t.Fatalf("%s: the text was not extracted", name)
+		}
+		if !strings.Contains(change.Contents, "token: xoxb-1") || !reflect.DeepEqual(change.PageStarts, []int{1}) {
+			t.Errorf("%s: got text %q and page starts %v", name, change.Contents, change.PageStarts)
+		}
+	}
+	if len(cache.texts) != 1 {
+		t.Errorf("cached %d texts, want 1", len(cache.texts))
+	}
+
+	// A previous version that cannot be read makes the document new
+	broken := "%PDF-1.7\n1 0 obj\n<< /Encrypt 2 0 R >>\nendobj\ntrailer\n<< /Encrypt 1 0 R >>\n%%EOF\n"
+	change := fileChange{
+		File:         memoryFile("c.pdf", []byte(onePagePDF)),
+		From:         memoryFile("c.pdf", []byte(broken)),
+		Kind:         pdfFile,
+		Contents:     onePagePDF,
+		FromContents: broken,
+	}
+	if !change.extractText(cache) || change.From != nil || change.FromContents != "" {
+		t.Errorf("got From %v and FromContents %q, want a new file", change.From, change.FromContents)
+	}
+
+	// A document that cannot be read is skipped
+	change = fileChange{File: memoryFile("d.pdf", []byte(broken)), Kind: pdfFile, Contents: broken}
+	if change.extractText(cache) {
+		t.Error("the text of an unreadable document was extracted")
+	}
+
+	// Other files are scanned as is
+	change = fileChange{File: memoryFile("e.md", []byte("token")), Kind: textFile, Contents: "token"}
+	if !change.extractText(cache) || change.Contents != "token" || change.PageStarts != nil {
+		t.Errorf("got text %q and page starts %v for a text file", change.Contents, change.PageStarts)
+	}
+}
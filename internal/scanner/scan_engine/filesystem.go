@@ -0,0 +1,99 @@
+package scan_engine
+
+import (
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"docser/internal/patterns"
+)
+
+// StartFilesystemScan walks a directory tree that does not need to be a git
+// repository and scans every text file it contains. Findings carry the path
+// relative to root and no commit metadata. Git metadata directories and the
+// files and directories matching the Ignore patterns are skipped.
+func StartFilesystemScan(root string, rs *patterns.Ruleset, opts Options) (*Results, error) {
+	results := &Results{}
+	p := startPool(opts.Threads, rs, newBlobCache(), results)
+
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			log.Printf("[!] Error accessing %s: %v\n", path, err)
+			return nil
+		}
+		if entry.IsDir() && entry.Name() == ".git" {
+			return filepath.SkipDir
+		}
+
+		relPath, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(relPath)
+		if entry.IsDir() {
+			// Ignored directories are not walked at all
+			if name != "." && opts.ignores(name, true) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// Skip symlinks, sockets and other special files
+		if !entry.Type().IsRegular() {
+			return nil
+		}
+		if !opts.includesPath(name) || opts.ignores(name, false) {
+			return nil
+		}
+
+		change, isText, err := loadFilesystemFile(path, name)
+		if err != nil {
+			log.Printf("[!] Error reading %s: %v\n", path, err)
+			return nil
+		}
+		if !isText {
+			return nil
+		}
+
+		if !p.submit(nil, []fileChange{change}) {
+			return errPoolStopped
+		}
+		return nil
+	})
+	if err == errPoolStopped {
+		err = nil
+	}
+
+	if poolErr := p.wait(); err == nil {
+		err = poolErr
+	}
+	return results, err
+}
+
+// loadFilesystemFile reads a text file or a PDF document from disk. Binary
+// files are detected from their first bytes and are not read any further. The
+// text of PDF documents is extracted by the worker scanning them.
+func loadFilesystemFile(path string, name string) (fileChange, bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return fileChange{}, false, err
+	}
+	defer f.Close()
+
+	// Check if the file type corresponds to text-based formats or PDF documents
+	kind := readerKind(name, f)
+	if kind == binaryFile {
+		return fileChange{}, false, nil
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return fileChange{}, false, err
+	}
+	contents, err := io.ReadAll(f)
+	if err != nil {
+		return fileChange{}, false, err
+	}
+
+	return fileChange{File: memoryFile(name, contents), Kind: kind, Contents: string(contents)}, true, nil
+}
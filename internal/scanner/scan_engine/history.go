@@ -0,0 +1,84 @@
+package scan_engine
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// resolveRange parses a "base..head" commit range. It returns the head commit
+// to walk from and the commits reachable from base, which are excluded from
+// the walk. An empty head defaults to HEAD, like git does.
+func resolveRange(repo *git.Repository, commitRange string) (*object.Commit, map[plumbing.Hash]bool, error) {
+	parts := strings.SplitN(commitRange, "..", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, nil, fmt.Errorf("invalid commit range %q, expected base..head", commitRange)
+	}
+
+	base, err := resolveCommit(repo, parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	headRevision := parts[1]
+	if headRevision == "" {
+		headRevision = "HEAD"
+	}
+	head, err := resolveCommit(repo, headRevision)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	excluded := make(map[plumbing.Hash]bool)
+	err = object.NewCommitPreorderIter(base, nil, nil).ForEach(func(commitObj *object.Commit) error {
+		excluded[commitObj.Hash] = true
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return head, excluded, nil
+}
+
+// resolveCommit returns the commit a revision such as a branch, a tag or a hash points to
+func resolveCommit(repo *git.Repository, revision string) (*object.Commit, error) {
+	hash, err := repo.ResolveRevision(plumbing.Revision(revision))
+	if err != nil {
+		return nil, fmt.Errorf("unable to resolve revision %q: %w", revision, err)
+	}
+	return repo.CommitObject(*hash)
+}
+
+// inWindow reports whether the commit was committed within the Since/Until window
+func (opts Options) inWindow(commitObj *object.Commit) bool {
+	when := commitObj.Committer.When
+	if !opts.Since.IsZero() && when.Before(opts.Since) {
+		return false
+	}
+	if !opts.Until.IsZero() && when.After(opts.Until) {
+		return false
+	}
+	return true
+}
+
+// includesPath reports whether the file is part of the Paths the history is limited to.
+// A path matches when it is equal to, inside of, or matched by the glob of one of the Paths.
+func (opts Options) includesPath(name string) bool {
+	if len(opts.Paths) == 0 {
+		return true
+	}
+	for _, limit := range opts.Paths {
+		limit = strings.TrimSuffix(limit, "/")
+		if name == limit || strings.HasPrefix(name, limit+"/") {
+			return true
+		}
+		if matched, _ := path.Match(limit, name); matched {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package scan_engine
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
+)
+
+// ParseIgnorePatterns reads gitignore patterns, one per line. Blank lines and
+// lines starting with "#" are skipped, trailing spaces are dropped unless they
+// are escaped with a backslash.
+func ParseIgnorePatterns(r io.Reader) ([]gitignore.Pattern, error) {
+	var ps []gitignore.Pattern
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " \t")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		ps = append(ps, gitignore.ParsePattern(line, nil))
+	}
+	return ps, scanner.Err()
+}
+
+// ignores reports whether the file or directory is excluded by the Ignore
+// patterns. Like git, the last pattern matching the path decides, so a "!"
+// pattern can include again a path excluded by an earlier one.
+func (opts Options) ignores(name string, isDir bool) bool {
+	if opts.Ignore == nil {
+		return false
+	}
+	return opts.Ignore.Match(strings.Split(name, "/"), isDir)
+}
@@ -0,0 +1,156 @@
+package scan_engine
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"docser/internal/patterns"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/filemode"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/index"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// StartProtect scans the changes that are not committed yet. Staged scans the
+// index against HEAD, Unstaged scans the worktree against the index. Only the
+// lines the changes introduce are reported, without commit metadata. Only the
+// Ignore patterns of opts are used.
+func StartProtect(repo *git.Repository, rs *patterns.Ruleset, staged bool, unstaged bool, opts Options) (*Results, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return nil, fmt.Errorf("error getting worktree: %w", err)
+	}
+
+	status, err := worktree.Status()
+	if err != nil {
+		return nil, fmt.Errorf("error getting worktree status: %w", err)
+	}
+
+	idx, err := repo.Storer.Index()
+	if err != nil {
+		return nil, fmt.Errorf("error reading index: %w", err)
+	}
+
+	// A repository without commits has an empty HEAD tree
+	var headTree *object.Tree
+	if headRef, err := repo.Head(); err == nil {
+		headCommit, err := repo.CommitObject(headRef.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("error getting commit: %w", err)
+		}
+		headTree, err = headCommit.Tree()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Sort the paths so the report does not depend on map ordering
+	var paths []string
+	for path := range status {
+		if opts.ignores(path, false) {
+			continue
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var changes []fileChange
+	for _, path := range paths {
+		fileStatus := status[path]
+
+		if staged && (fileStatus.Staging == git.Added || fileStatus.Staging == git.Modified) {
+			change, err := stagedChange(repo, idx, headTree, path)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+
+		if unstaged && fileStatus.Worktree == git.Modified {
+			change, err := unstagedChange(repo, worktree, idx, path)
+			if err != nil {
+				return nil, err
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	var textChanges []fileChange
+	for _, change := range changes {
+		isText, err := change.loadContents()
+		if err != nil {
+			return nil, err
+		}
+		if isText {
+			textChanges = append(textChanges, change)
+		}
+	}
+
+	results := &Results{}
+	err = scanChanges(textChanges, nil, rs, newBlobCache(), results)
+	return results, err
+}
+
+// stagedChange compares the staged version of a file with the version in HEAD
+func stagedChange(repo *git.Repository, idx *index.Index, headTree *object.Tree, path string) (fileChange, error) {
+	staged, err := indexFile(repo, idx, path)
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	change := fileChange{File: staged}
+	if headTree != nil {
+		if from, err := headTree.File(path); err == nil {
+			change.From = from
+		}
+	}
+	return change, nil
+}
+
+// unstagedChange compares the version of a file in the worktree with the staged version
+func unstagedChange(repo *git.Repository, worktree *git.Worktree, idx *index.Index, path string) (fileChange, error) {
+	from, err := indexFile(repo, idx, path)
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	f, err := worktree.Filesystem.Open(path)
+	if err != nil {
+		return fileChange{}, err
+	}
+	defer f.Close()
+
+	contents, err := io.ReadAll(f)
+	if err != nil {
+		return fileChange{}, err
+	}
+
+	return fileChange{File: memoryFile(path, contents), From: from}, nil
+}
+
+// indexFile returns the staged version of a file
+func indexFile(repo *git.Repository, idx *index.Index, path string) (*object.File, error) {
+	entry, err := idx.Entry(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s from the index: %w", path, err)
+	}
+
+	blob, err := repo.BlobObject(entry.Hash)
+	if err != nil {
+		return nil, err
+	}
+	return object.NewFile(path, entry.Mode, blob), nil
+}
+
+// memoryFile wraps contents that are not stored in the repository in a File
+func memoryFile(path string, contents []byte) *object.File {
+	obj := &plumbing.MemoryObject{}
+	obj.SetType(plumbing.BlobObject)
+	obj.Write(contents)
+
+	blob, _ := object.DecodeBlob(obj)
+	return object.NewFile(path, filemode.Regular, blob)
+}
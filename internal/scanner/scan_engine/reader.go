@@ -0,0 +1,31 @@
+package scan_engine
+
+import (
+	"bytes"
+	"io"
+	"log"
+
+	"docser/internal/patterns"
+)
+
+// StartReaderScan scans the text read from a reader, such as stdin or a single
+// file. Findings carry the given name and no commit metadata. PDF documents are
+// scanned through the text of their pages, other binary contents are skipped.
+func StartReaderScan(name string, reader io.Reader, rs *patterns.Ruleset) (*Results, error) {
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &Results{}
+	// Check if the contents correspond to text-based formats or PDF documents
+	kind := readerKind(name, bytes.NewReader(contents))
+	if kind == binaryFile {
+		log.Printf("[!] Skipping %s: not a text file\n", name)
+		return results, nil
+	}
+
+	change := fileChange{File: memoryFile(name, contents), Kind: kind, Contents: string(contents)}
+	err = scanChanges([]fileChange{change}, nil, rs, newBlobCache(), results)
+	return results, err
+}
@@ -0,0 +1,98 @@
+package scan_engine
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strings"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// startCommits returns the commits the history walk starts from. By default
+// this is the commit HEAD points to. With AllRefs every local branch,
+// remote-tracking branch, tag and other reference under refs/ is used, and
+// with Refs only the references whose full or short name matches one of the
+// given names or globs. Commits pointed to by several references are only
+// returned once.
+func startCommits(repo *git.Repository, refs []*plumbing.Reference, opts Options) ([]*object.Commit, error) {
+	if !opts.AllRefs && len(opts.Refs) == 0 {
+		// Open the repository's HEAD reference to get the reference's hash
+		headRef, err := repo.Head()
+		if err != nil {
+			return nil, fmt.Errorf("error getting HEAD reference: %w", err)
+		}
+
+		// Get the commit object of the HEAD reference
+		commit, err := repo.CommitObject(headRef.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("error getting commit: %w", err)
+		}
+		return []*object.Commit{commit}, nil
+	}
+
+	var commits []*object.Commit
+	seen := make(map[plumbing.Hash]bool)
+	for _, ref := range refs {
+		if !selectRef(ref, opts) {
+			continue
+		}
+
+		// Symbolic references such as HEAD point to another reference
+		if ref.Type() == plumbing.SymbolicReference {
+			resolved, err := repo.Reference(ref.Name(), true)
+			if err != nil {
+				log.Printf("[!] Skipping reference %s: %v\n", ref.Name(), err)
+				continue
+			}
+			ref = resolved
+		}
+
+		commit, err := refCommit(repo, ref)
+		if err != nil {
+			log.Printf("[!] Skipping reference %s: %v\n", ref.Name(), err)
+			continue
+		}
+		if seen[commit.Hash] {
+			continue
+		}
+		seen[commit.Hash] = true
+		commits = append(commits, commit)
+	}
+
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no references matched %v", opts.Refs)
+	}
+	return commits, nil
+}
+
+// selectRef reports whether the walk should start from the reference
+func selectRef(ref *plumbing.Reference, opts Options) bool {
+	name := ref.Name()
+
+	// Symbolic references such as origin/HEAD are covered by the branch they point
+	// to. Besides branches and tags, mirror clones hold refs such as refs/pull/*.
+	if opts.AllRefs && ref.Type() == plumbing.HashReference && strings.HasPrefix(name.String(), "refs/") {
+		return true
+	}
+
+	for _, pattern := range opts.Refs {
+		for _, candidate := range []string{name.String(), name.Short()} {
+			if matched, _ := path.Match(pattern, candidate); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// refCommit resolves the commit a reference points to, peeling annotated tags
+func refCommit(repo *git.Repository, ref *plumbing.Reference) (*object.Commit, error) {
+	hash := ref.Hash()
+	if tag, err := repo.TagObject(hash); err == nil {
+		return tag.Commit()
+	}
+	return repo.CommitObject(hash)
+}
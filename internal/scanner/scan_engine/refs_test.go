@@ -0,0 +1,77 @@
+package scan_engine
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/src-d/go-git.v4/plumbing"
+)
+
+func TestStartCommits(t *testing.T) {
+	r := newTestRepo(t)
+	root := r.commit(map[string]string{"a.txt": "a\n"})
+	master := r.commit(map[string]string{"a.txt": "a\nb\n"}, root)
+	feat := r.commit(map[string]string{"a.txt": "a\nc\n"}, root)
+
+	for _, ref := range []*plumbing.Reference{
+		plumbing.NewHashReference("refs/heads/master", master),
+		plumbing.NewHashReference("refs/heads/feat-1", feat),
+		plumbing.NewHashReference("refs/heads/feat-2", feat),
+		plumbing.NewHashReference("refs/tags/v1", root),
+	} {
+		if err := r.repo.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+	iter, err := r.repo.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []*plumbing.Reference
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+
+	tests := []struct {
+		name string
+		opts Options
+		want []plumbing.Hash
+		err  string
+	}{
+		{name: "HEAD", opts: Options{}, want: []plumbing.Hash{master}},
+		{name: "short name", opts: Options{Refs: []string{"v1"}}, want: []plumbing.Hash{root}},
+		{name: "full name", opts: Options{Refs: []string{"refs/heads/master"}}, want: []plumbing.Hash{master}},
+		{name: "glob matching one commit twice", opts: Options{Refs: []string{"feat-*"}}, want: []plumbing.Hash{feat}},
+		{name: "all references", opts: Options{AllRefs: true}, want: []plumbing.Hash{master, feat, root}},
+		{name: "no match", opts: Options{Refs: []string{"nosuch"}}, err: "no references matched [nosuch]"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			commits, err := startCommits(r.repo, refs, tt.opts)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("got error %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[plumbing.Hash]bool)
+			for _, commit := range commits {
+				got[commit.Hash] = true
+			}
+			if len(commits) != len(tt.want) {
+				t.Errorf("got %d commits, want %d", len(commits), len(tt.want))
+			}
+			for _, hash := range tt.want {
+				if !got[hash] {
+					t.Errorf("commit %s was not returned", hash)
+				}
+			}
+		})
+	}
+}
@@ -1,110 +1,247 @@
 package scan_engine
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"strings"
+	"time"
 
 	"docser/internal/patterns"
+	"docser/internal/pdf"
+	"docser/internal/report"
 
 	"gopkg.in/h2non/filetype.v1"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
 	"gopkg.in/src-d/go-git.v4/plumbing/object"
 )
 
-// StartScanEngine is an exported function from the ScanEngine package
-func StartScanEngine(repo *git.Repository, refs []*plumbing.Reference, configFile string) {
-	repository := *repo
-	configFunc := repository.Config
+var (
+	// errPoolStopped stops the history walk once a worker failed
+	errPoolStopped = errors.New("scan stopped")
+	// errWalkDone stops the history walk once MaxCommits were walked
+	errWalkDone = errors.New("walk done")
+)
 
-	// Call the repository.Config function to get the configuration and error
-	_, err := configFunc()
-	if err != nil {
-		log.Printf("Error getting repository configuration: %v\n", err)
-		return
-	}
+// Results holds the findings and counters collected while walking a repository
+type Results struct {
+	Findings []report.Finding
+	// Suppressed holds the findings marked as intended by a docser:allow comment
+	Suppressed     []report.Finding
+	CommitsScanned int
+	FilesScanned   int
+}
 
-	// Open the repository's HEAD reference to get the reference's hash
-	headRef, err := repo.Head()
-	if err != nil {
-		log.Printf("Error getting HEAD reference: %v\n", err)
-		return
-	}
+// Options controls how the scan engine walks a repository
+type Options struct {
+	// Threads is the number of workers matching blobs concurrently
+	Threads int
+	// AllRefs walks the history of every branch, remote-tracking branch, tag and other reference
+	AllRefs bool
+	// Refs walks the history of the references matching these names or globs
+	Refs []string
+	// Range limits the walk to the commits of a "base..head" range
+	Range string
+	// Since and Until limit the walk to commits committed within this window
+	Since time.Time
+	Until time.Time
+	// MaxCommits stops the walk after this many commits, when positive
+	MaxCommits int
+	// Paths limits the walk to the commits changing these files or directories
+	Paths []string
+	// Ignore excludes the files matching the patterns of .docserignore files
+	Ignore gitignore.Matcher
+}
 
-	// Retrieve the hash of the HEAD reference
-	headHash := headRef.Hash()
+// StartScanEngine walks the history of the repository and scans the files
+// changed by each commit. It fails when the commits to start from cannot be
+// resolved, for instance when no reference matches opts.Refs or the range is
+// invalid, and when reading the history or scanning a file fails.
+func StartScanEngine(repo *git.Repository, refs []*plumbing.Reference, rs *patterns.Ruleset, opts Options) (*Results, error) {
+	results := &Results{}
 
-	// Get the commit object of the HEAD reference
-	commit, err := repo.CommitObject(headHash)
-	if err != nil {
-		log.Printf("Error getting commit: %v\n", err)
-		return
+	if _, err := repo.Config(); err != nil {
+		return nil, fmt.Errorf("error getting repository configuration: %w", err)
+	}
+
+	// Resolve the commits to walk the history from
+	var commits []*object.Commit
+	excluded := make(map[plumbing.Hash]bool)
+	if opts.Range != "" {
+		head, rangeExcluded, err := resolveRange(repo, opts.Range)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving range: %w", err)
+		}
+		commits, excluded = []*object.Commit{head}, rangeExcluded
+	} else {
+		var err error
+		commits, err = startCommits(repo, refs, opts)
+		if err != nil {
+			return nil, fmt.Errorf("error resolving references: %w", err)
+		}
 	}
 
 	// Iterate through each commit in the repository
-	err = iterateCommits(repo, commit, configFile)
+	p := startPool(opts.Threads, rs, newBlobCache(), results)
+	err := iterateCommits(commits, excluded, shallowParents(repo), opts, p)
+	if poolErr := p.wait(); err == nil {
+		err = poolErr
+	}
 	if err != nil {
-		log.Printf("Error iterating commits: %v\n", err)
-		return
+		return nil, fmt.Errorf("error iterating commits: %w", err)
 	}
+	return results, nil
 }
 
-// iterateCommits iterates through each commit and processes files
-func iterateCommits(repo *git.Repository, commit *object.Commit, configFile string) error {
-	commitIter, err := repo.Log(&git.LogOptions{From: commit.Hash})
-	if err != nil {
-		return err
-	}
-	defer commitIter.Close()
+// iterateCommits walks the history of each start commit and feeds the files
+// changed by every commit to the pool. Commits shared by several histories and
+// excluded commits are not walked, commits outside of the date window are
+// walked through without being scanned. Missing commits, the parents cut off
+// by a shallow clone, are never looked up.
+func iterateCommits(commits []*object.Commit, excluded map[plumbing.Hash]bool, missing []plumbing.Hash, opts Options, p *pool) error {
+	seen := excluded
+	submitted := 0
+	for _, commit := range commits {
+		commitIter := object.NewCommitPreorderIter(commit, seen, missing)
+		err := commitIter.ForEach(func(commitObj *object.Commit) error {
+			seen[commitObj.Hash] = true
+			if !opts.inWindow(commitObj) {
+				return nil
+			}
+			if opts.MaxCommits > 0 && submitted >= opts.MaxCommits {
+				return errWalkDone
+			}
 
-	return commitIter.ForEach(func(commitObj *object.Commit) error {
+			// Access the files changed by the commit
+			changes, err := loadCommitFiles(commitObj, opts)
+			if err != nil {
+				return err
+			}
+			// A path-limited history only holds the commits changing those paths
+			if len(opts.Paths) > 0 && len(changes) == 0 {
+				return nil
+			}
 
-		// Access and process the files in the commit
-		err := processCommitFiles(commitObj, configFile)
+			submitted++
+			if !p.submit(commitObj, changes) {
+				return errPoolStopped
+			}
+			return nil
+		})
+		commitIter.Close()
+		if err == errPoolStopped || err == errWalkDone {
+			// Stopping the walk is not an error, the pool reports why a worker failed
+			return nil
+		}
 		if err != nil {
 			return err
 		}
+	}
+	return nil
+}
 
+// shallowParents returns the parents of the commits at the boundary of a
+// shallow clone that are not part of the repository. A parent can be present
+// when it was fetched for another branch, for instance the tip of a branch
+// another one was branched from, and is then walked like any other commit.
+func shallowParents(repo *git.Repository) []plumbing.Hash {
+	shallow, err := repo.Storer.Shallow()
+	if err != nil {
+		log.Printf("Error reading shallow commits: %v\n", err)
 		return nil
-	})
+	}
+
+	var parents []plumbing.Hash
+	for _, hash := range shallow {
+		commit, err := repo.CommitObject(hash)
+		if err != nil {
+			continue
+		}
+		for _, parent := range commit.ParentHashes {
+			if _, err := repo.CommitObject(parent); err == plumbing.ErrObjectNotFound {
+				parents = append(parents, parent)
+			}
+		}
+	}
+	return parents
 }
 
-// processCommitFiles accesses and processes the files in the commit
-func processCommitFiles(commitObj *object.Commit, configFile string) error {
-	fileIter, err := commitObj.Files()
+// loadCommitFiles accesses the text files added or modified by the commit and
+// loads their contents
+func loadCommitFiles(commitObj *object.Commit, opts Options) ([]fileChange, error) {
+	changes, err := commitChanges(commitObj)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer fileIter.Close()
-
-	return fileIter.ForEach(func(file *object.File) error {
-		// Check if the file type corresponds to text-based formats
-		if isTextFile(file) {
-			results, err := patterns.ProcessTextFileContentsWithRegex(file, configFile)
 
-			if (err == nil) && (len(results) != 0) {
-				fmt.Println("Hash:", commitObj.Hash)
-				fmt.Println("File:", file.Name)
-				for _, result := range results {
-					fmt.Println("Results:", result)
-				}
-			}
+	var textChanges []fileChange
+	for _, change := range changes {
+		if !opts.includesPath(change.File.Name) || opts.ignores(change.File.Name, false) {
+			continue
+		}
 
-			if err != nil {
-				return err
-			}
+		isText, err := change.loadContents()
+		if err != nil {
+			return nil, err
 		}
-		return nil
-	})
+		if isText {
+			textChanges = append(textChanges, change)
+		}
+	}
+	return textChanges, nil
 }
 
-// isTextFile checks if the file extension corresponds to a text-based format by checking magic byte of the file
-func isTextFile(file *object.File) bool {
+// newFinding attaches the commit metadata, if any, to a pattern match
+func newFinding(commitObj *object.Commit, match patterns.MatchResult) report.Finding {
+	finding := report.Finding{
+		RuleID:      match.RuleID,
+		Rule:        match.Pattern,
+		Severity:    match.Severity,
+		Confidence:  match.Confidence,
+		Tags:        match.Tags,
+		Remediation: match.Remediation,
+		Entropy:     match.Entropy,
+		Placeholder: match.Placeholder,
+		Context:     match.Context,
+		Language:    match.Language,
+		File:        match.FileName,
+		Line:        match.LineNumber,
+		EndLine:     match.EndLine,
+		StartColumn: match.StartColumn,
+		EndColumn:   match.EndColumn,
+		Match:       match.MatchString,
+		Secret:      match.Secret,
+		SecretStart: match.SecretStart,
+		SecretEnd:   match.SecretEnd,
+	}
+	if commitObj != nil {
+		finding.Commit = commitObj.Hash.String()
+		finding.Author = commitObj.Author.Name
+		finding.Email = commitObj.Author.Email
+		finding.Date = commitObj.Author.When.UTC().Format(time.RFC3339)
+		finding.Message = strings.TrimSpace(commitObj.Message)
+	}
+	return finding
+}
+
+// fileKind tells how the contents of a file are scanned
+type fileKind int
+
+const (
+	binaryFile fileKind = iota // Not scanned
+	textFile                   // Scanned as is
+	pdfFile                    // Scanned through the text of its pages
+)
+
+// fileKindOf checks the magic bytes of the file to tell whether it holds a text-based format or a PDF document
+func fileKindOf(file *object.File) fileKind {
 	fileReader, err := file.Reader() // Assuming 'Reader' is a method in your 'object.File' type
 	if err != nil {
 		log.Printf("Error opening %s: %v\n", file.Name, err)
-		return false
+		return binaryFile
 	}
 	defer func(fileReader io.ReadCloser) {
 		err := fileReader.Close()
@@ -113,15 +250,50 @@ func isTextFile(file *object.File) bool {
 		}
 	}(fileReader)
 
+	return readerKind(file.Name, fileReader)
+}
+
+// readerKind checks the magic bytes at the start of the reader to tell whether it holds a text-based format or a PDF document
+func readerKind(name string, reader io.Reader) fileKind {
 	bufferSize := 261
 	buffer := make([]byte, bufferSize) // Read the first 261 bytes for magic number detection
-	bufLen, err := fileReader.Read(buffer)
+	bufLen, err := reader.Read(buffer)
 	if (err != nil) && (bufLen > bufferSize) {
-		log.Printf("Error reading %s: %v\n", file.Name, err)
-		return false
+		log.Printf("Error reading %s: %v\n", name, err)
+		return binaryFile
 	}
 
 	kind, _ := filetype.Match(buffer)
 
-	return kind == filetype.Unknown
+	switch {
+	case kind == filetype.Unknown:
+		return textFile
+	case kind.Extension == "pdf":
+		return pdfFile
+	}
+	return binaryFile
+}
+
+// readContents returns the text of the pages of a PDF document and the line
+// each page starts on. It returns false when the text cannot be read.
+func readContents(name string, contents []byte) (string, []int, bool) {
+	pages, err := pdf.ExtractText(contents)
+	if errors.Is(err, pdf.ErrTruncated) {
+		log.Printf("[!] %s: %v\n", name, err)
+	} else if err != nil {
+		log.Printf("[!] Skipping %s: %v\n", name, err)
+		return "", nil, false
+	}
+
+	// Pages follow each other, each one starting on a new line
+	var text strings.Builder
+	pageStarts := make([]int, len(pages))
+	line := 1
+	for i, page := range pages {
+		pageStarts[i] = line
+		text.WriteString(page)
+		text.WriteString("\n")
+		line += strings.Count(page, "\n") + 1
+	}
+	return text.String(), pageStarts, true
 }
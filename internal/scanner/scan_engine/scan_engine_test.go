@@ -0,0 +1,76 @@
+package scan_engine
+
+import (
+	"path/filepath"
+	"testing"
+
+	"docser/internal/patterns"
+
+	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/storage/memory"
+)
+
+// TestShallowCloneOfStackedBranches scans a depth 1 clone of a branch created
+// on top of another one: the tip of the first branch is both a shallow commit
+// and the parent of the second one, and must be scanned
+func TestShallowCloneOfStackedBranches(t *testing.T) {
+	dir := t.TempDir()
+	source, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, err := source.Worktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &testRepo{t: t, repo: source, worktree: worktree}
+
+	root := r.commit(map[string]string{"a.txt": "a\n"})
+	master := r.commit(map[string]string{"a.txt": "a\n", "b.txt": "b\n"}, root)
+	feat := r.commit(map[string]string{"a.txt": "a\n", "b.txt": "b\n", "c.txt": "c\n"}, master)
+	for name, hash := range map[string]plumbing.Hash{"master": master, "feat": feat} {
+		ref := plumbing.NewHashReference(plumbing.NewBranchReferenceName(name), hash)
+		if err := source.Storer.SetReference(ref); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clone, err := git.Clone(memory.NewStorage(), nil, &git.CloneOptions{
+		URL:   "file://" + filepath.ToSlash(dir),
+		Depth: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := clone.CommitObject(root); err != plumbing.ErrObjectNotFound {
+		t.Fatalf("the root commit should be cut off by the clone, got %v", err)
+	}
+
+	missing := shallowParents(clone)
+	if len(missing) != 1 || missing[0] != root {
+		t.Errorf("shallowParents = %v, want [%s]", missing, root)
+	}
+
+	iter, err := clone.References()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var refs []*plumbing.Reference
+	iter.ForEach(func(ref *plumbing.Reference) error {
+		refs = append(refs, ref)
+		return nil
+	})
+	rs, err := patterns.LoadRuleset("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err := StartScanEngine(clone, refs, rs, Options{AllRefs: true, Threads: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// master is scanned like a root commit, feat only adds c.txt
+	if results.CommitsScanned != 2 || results.FilesScanned != 3 {
+		t.Errorf("scanned %d commits and %d files, want 2 commits and 3 files", results.CommitsScanned, results.FilesScanned)
+	}
+}
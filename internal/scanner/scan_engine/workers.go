@@ -0,0 +1,173 @@
+package scan_engine
+
+import (
+	"sync"
+
+	"docser/internal/patterns"
+
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
+)
+
+// commitJob is a commit whose changed files were loaded by the commit walker
+// and are ready to be scanned by a worker. The commit is nil for files that are
+// scanned outside of the history.
+type commitJob struct {
+	seq     int
+	commit  *object.Commit
+	changes []fileChange
+}
+
+// commitResult holds what a worker found in a commitJob
+type commitResult struct {
+	seq       int
+	committed bool // false for jobs of files that are not part of a commit
+	found     Results
+	err       error
+}
+
+// pool scans commit jobs on a bounded number of workers. Results are handed to
+// a single collector in the order the commits were walked, so the report is the
+// same whatever the number of workers.
+type pool struct {
+	jobs    chan commitJob
+	results chan commitResult
+	stop    chan struct{}
+	done    chan struct{}
+	workers sync.WaitGroup
+
+	nextSeq int
+	err     error
+}
+
+// startPool starts the workers and the collector appending to results
+func startPool(threads int, rs *patterns.Ruleset, cache *blobCache, results *Results) *pool {
+	if threads < 1 {
+		threads = 1
+	}
+
+	p := &pool{
+		jobs:    make(chan commitJob, threads*2),
+		results: make(chan commitResult, threads*2),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	for i := 0; i < threads; i++ {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				p.results <- scanCommitJob(job, rs, cache)
+			}
+		}()
+	}
+
+	go p.collect(results)
+	return p
+}
+
+// submit queues the changes of the next walked commit. It returns false once
+// the pool stopped because of an error.
+func (p *pool) submit(commitObj *object.Commit, changes []fileChange) bool {
+	job := commitJob{seq: p.nextSeq, commit: commitObj, changes: changes}
+	p.nextSeq++
+
+	select {
+	case p.jobs <- job:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// wait waits for every submitted job to be collected and returns the first error
+func (p *pool) wait() error {
+	close(p.jobs)
+	p.workers.Wait()
+	close(p.results)
+	<-p.done
+	return p.err
+}
+
+// collect reorders the worker results by sequence number and appends them to results
+func (p *pool) collect(results *Results) {
+	defer close(p.done)
+
+	pending := make(map[int]commitResult)
+	next := 0
+	for result := range p.results {
+		pending[result.seq] = result
+		for {
+			result, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			next++
+
+			if p.err != nil {
+				continue
+			}
+			if result.err != nil {
+				p.err = result.err
+				close(p.stop)
+				continue
+			}
+			if result.committed {
+				results.CommitsScanned++
+			}
+			results.FilesScanned += result.found.FilesScanned
+			results.Findings = append(results.Findings, result.found.Findings...)
+			results.Suppressed = append(results.Suppressed, result.found.Suppressed...)
+		}
+	}
+}
+
+// scanCommitJob matches the changed files of a commit
+func scanCommitJob(job commitJob, rs *patterns.Ruleset, cache *blobCache) commitResult {
+	result := commitResult{seq: job.seq, committed: job.commit != nil}
+	result.err = scanChanges(job.changes, job.commit, rs, cache, &result.found)
+	return result
+}
+
+// scanChanges matches the changed files and appends to results the matches on
+// lines the change introduced. The commit is nil for changes that are not
+// committed yet.
+func scanChanges(changes []fileChange, commitObj *object.Commit, rs *patterns.Ruleset, cache *blobCache, results *Results) error {
+	commitHash := ""
+	if commitObj != nil {
+		commitHash = commitObj.Hash.String()
+	}
+
+	for i := range changes {
+		change := &changes[i]
+		if !change.extractText(cache) {
+			continue
+		}
+		if change.From != nil {
+			change.AddedLines = addedLines(change.FromContents, change.Contents)
+		}
+
+		matches, scanned, err := cache.scan(change, rs)
+		if err != nil {
+			return err
+		}
+		if scanned {
+			results.FilesScanned++
+		}
+
+		for _, match := range matches {
+			if !change.includes(match.LineNumber, match.EndLine) || rs.IsAllowed(match, commitHash) {
+				continue
+			}
+			finding := newFinding(commitObj, match)
+			change.locate(&finding)
+			if match.Suppressed {
+				results.Suppressed = append(results.Suppressed, finding)
+				continue
+			}
+			results.Findings = append(results.Findings, finding)
+		}
+	}
+	return nil
+}
@@ -1,68 +1,310 @@
 package scanner
 
 import (
+	"docser/internal/patterns"
+	"docser/internal/report"
 	"docser/internal/scanner/scan_engine"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/format/gitignore"
 )
 
-func isGitRepository(repositoryPath string) bool {
+// checkGitRepository makes sure the path holds a git repository, with or
+// without a worktree
+func checkGitRepository(repositoryPath string) error {
 	repo, err := git.PlainOpen(repositoryPath)
 	if err != nil {
-		log.Printf("[!] Error opening repository: %v\n", err)
-		return false
+		return fmt.Errorf("error opening repository %s: %w (use -no-git to scan a directory that is not a repository)", repositoryPath, err)
 	}
 
+	// Bare repositories, mirror clones and .git directories have no worktree,
+	// their history is read from the object database directly
 	worktree, err := repo.Worktree()
+	if err == git.ErrIsBareRepository {
+		return nil
+	}
 	if err != nil {
-		log.Printf("[!] Error getting worktree: %v\n", err)
-		return false
+		return fmt.Errorf("error getting worktree: %w", err)
 	}
 
 	_, err = os.Stat(worktree.Filesystem.Root())
 	if err != nil {
-		log.Printf("[!] Error checking repository path: %v\n", err)
-		return false
+		return fmt.Errorf("error checking repository path: %w", err)
 	}
-	return true
+	return nil
+}
+
+// Options holds the command line settings of a scan
+type Options struct {
+	RepositoryPath string
+	ConfigFile     string
+	Format         string
+	Output         string
+	Version        string
+	Threads        int
+	AllRefs        bool
+	Refs           []string
+	Range          string
+	Since          time.Time
+	Until          time.Time
+	MaxCommits     int
+	Paths          []string
+	IgnoreFile     string
+	Staged         bool
+	Unstaged       bool
+	NoGit          bool
+	ShowSuppressed bool
+	Baseline       string
+	RepoURL        string
+	Clone          CloneOptions
 }
 
-func ParseConfigAndInitiateScan(configFile string, repositoryPath string) {
-	if repositoryPath != "" {
-		initiateScanAndValidatePath(repositoryPath, configFile)
+// ParseConfigAndInitiateScan scans the repository described by opts and writes
+// the report in the requested format. The report is returned so the caller can
+// decide on an exit code.
+func ParseConfigAndInitiateScan(opts Options) (*report.Report, error) {
+	if opts.RepositoryPath == "" {
+		opts.RepositoryPath = "."
+	}
+	return initiateScanAndValidatePath(opts)
+}
+
+func initiateScanAndValidatePath(opts Options) (*report.Report, error) {
+	if opts.RepoURL == "" {
+		opts.ConfigFile = defaultConfigFile(opts)
+	}
+	if opts.NoGit {
+		return scanDirectory(opts)
+	}
+	if opts.RepoURL != "" {
+		return scanRemote(opts)
+	}
+
+	if err := checkGitRepository(opts.RepositoryPath); err != nil {
+		return nil, err
+	}
+
+	if opts.RepositoryPath == "." {
+		log.Printf("[+] Initiating Scan in current directory.\n")
 	} else {
-		initiateScanAndValidatePath(".", configFile)
+		log.Printf("[+] Initiating Scan in %s \n", opts.RepositoryPath)
+	}
+
+	repo, err := git.PlainOpen(opts.RepositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	rs, rep, err := prepareScan(opts)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := loadIgnore(opts, repo)
+	if err != nil {
+		return nil, err
+	}
+	results, err := startScanEngine(repo, opts, rs, ignore)
+	if err != nil {
+		return nil, err
+	}
+	return rep, finishScan(opts, rep, results)
+}
+
+// Protect scans the staged changes, and the unstaged ones when requested, of the
+// repository described by opts and writes the report in the requested format.
+// Staged changes are scanned when neither kind is requested.
+func Protect(opts Options) (*report.Report, error) {
+	if opts.RepositoryPath == "" {
+		opts.RepositoryPath = "."
+	}
+	if !opts.Staged && !opts.Unstaged {
+		opts.Staged = true
+	}
+	opts.ConfigFile = defaultConfigFile(opts)
+
+	repo, err := git.PlainOpen(opts.RepositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening repository: %w", err)
+	}
+
+	rs, rep, err := prepareScan(opts)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := loadIgnore(opts, repo)
+	if err != nil {
+		return nil, err
+	}
+	results, err := scan_engine.StartProtect(repo, rs, opts.Staged, opts.Unstaged, scan_engine.Options{Ignore: ignore})
+	if err != nil {
+		return nil, err
+	}
+	return rep, finishScan(opts, rep, results)
+}
+
+// scanDirectory scans the files of a directory tree without reading any git metadata
+func scanDirectory(opts Options) (*report.Report, error) {
+	info, err := os.Stat(opts.RepositoryPath)
+	if err != nil {
+		return nil, fmt.Errorf("error checking directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", opts.RepositoryPath)
+	}
+
+	log.Printf("[+] Initiating filesystem scan in %s \n", opts.RepositoryPath)
+
+	rs, rep, err := prepareScan(opts)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := loadIgnore(opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	results, err := scan_engine.StartFilesystemScan(opts.RepositoryPath, rs, scan_engine.Options{
+		Threads: opts.Threads,
+		Paths:   opts.Paths,
+		Ignore:  ignore,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rep, finishScan(opts, rep, results)
+}
+
+// ScanFiles scans single files and writes the report in the requested format.
+// A "-" path reads from stdin and a directory is scanned like with NoGit.
+func ScanFiles(opts Options, paths []string) (*report.Report, error) {
+	opts.RepositoryPath = strings.Join(paths, " ")
+	rs, rep, err := prepareScan(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	results := &scan_engine.Results{}
+	for _, path := range paths {
+		pathResults, err := scanFile(path, opts, rs)
+		if err != nil {
+			return nil, err
+		}
+		results.Findings = append(results.Findings, pathResults.Findings...)
+		results.Suppressed = append(results.Suppressed, pathResults.Suppressed...)
+		results.FilesScanned += pathResults.FilesScanned
 	}
+	return rep, finishScan(opts, rep, results)
 }
 
-func initiateScanAndValidatePath(repositoryPath string, configFile string) {
-	if repositoryPath == "." {
-		if isGitRepository(repositoryPath) {
-			log.Printf("[+] Initiating Scan in current directory.\n")
-			startScanEngine(repositoryPath, configFile)
+func scanFile(path string, opts Options, rs *patterns.Ruleset) (*scan_engine.Results, error) {
+	if path == "-" {
+		return scan_engine.StartReaderScan("stdin", os.Stdin, rs)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		// The .docserignore of the directory applies, like in scans with NoGit
+		dirOpts := opts
+		dirOpts.RepositoryPath = path
+		ignore, err := loadIgnore(dirOpts, nil)
+		if err != nil {
+			return nil, err
 		}
-	} else {
-		if isGitRepository(repositoryPath) {
-			log.Printf("[+] Initiating Scan in %s \n", repositoryPath)
-			startScanEngine(repositoryPath, configFile)
+		results, err := scan_engine.StartFilesystemScan(path, rs, scan_engine.Options{Threads: opts.Threads, Ignore: ignore})
+		if err != nil {
+			return nil, err
+		}
+		// Report the files relative to the working directory, like the other paths
+		for i := range results.Findings {
+			results.Findings[i].File = filepath.ToSlash(filepath.Join(path, results.Findings[i].File))
+		}
+		for i := range results.Suppressed {
+			results.Suppressed[i].File = filepath.ToSlash(filepath.Join(path, results.Suppressed[i].File))
 		}
+		return results, nil
 	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return scan_engine.StartReaderScan(filepath.ToSlash(path), file, rs)
 }
 
-func startScanEngine(repositoryPath string, configFile string) {
-	repo, err := git.PlainOpen(repositoryPath)
+// defaultConfigFile returns the config file given on the command line, or the
+// .docser.toml at the root of the scanned directory when there is one
+func defaultConfigFile(opts Options) string {
+	if opts.ConfigFile != "" {
+		return opts.ConfigFile
+	}
+
+	configFile := filepath.Join(opts.RepositoryPath, ".docser.toml")
+	if info, err := os.Stat(configFile); err == nil && info.Mode().IsRegular() {
+		log.Printf("[+] Using config file %s\n", configFile)
+		return configFile
+	}
+	return ""
+}
+
+// prepareScan loads the patterns and creates the report of a scan
+func prepareScan(opts Options) (*patterns.Ruleset, *report.Report, error) {
+	rs, err := patterns.LoadRuleset(opts.ConfigFile)
 	if err != nil {
-		log.Printf("[!] Error opening repository: %v\n", err)
-		return
+		return nil, nil, fmt.Errorf("unable to load patterns: %w", err)
 	}
 
+	rep := report.New(opts.Version, opts.RepositoryPath)
+	if opts.Baseline != "" {
+		// Load the baseline before scanning so a bad path fails fast
+		rep.Baseline, err = report.LoadBaseline(opts.Baseline)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, pattern := range rs.Patterns {
+		rep.Rules = append(rep.Rules, report.Rule{
+			ID:          pattern.RuleID(),
+			Description: pattern.Description,
+			Severity:    pattern.Severity,
+			Confidence:  pattern.Confidence,
+			Tags:        pattern.Tags,
+			Remediation: pattern.Remediation,
+		})
+	}
+	return rs, rep, nil
+}
+
+// finishScan adds the results to the report and writes it
+func finishScan(opts Options, rep *report.Report, results *scan_engine.Results) error {
+	if results != nil {
+		rep.Findings = append(rep.Findings, results.Findings...)
+		rep.Summary.Suppressed = len(results.Suppressed)
+		if opts.ShowSuppressed {
+			rep.Suppressed = append(rep.Suppressed, results.Suppressed...)
+		}
+		rep.Summary.CommitsScanned = results.CommitsScanned
+		rep.Summary.FilesScanned = results.FilesScanned
+	}
+	rep.Finish()
+
+	return report.WriteFile(opts.Output, opts.Format, rep)
+}
+
+func startScanEngine(repo *git.Repository, opts Options, rs *patterns.Ruleset, ignore gitignore.Matcher) (*scan_engine.Results, error) {
 	refs, err := repo.References()
 	if err != nil {
-		log.Printf("[!] Error getting references: %v\n", err)
-		return
+		return nil, fmt.Errorf("error getting references: %w", err)
 	}
 
 	var plumbingRefs []*plumbing.Reference
@@ -71,9 +313,18 @@ func startScanEngine(repositoryPath string, configFile string) {
 		return nil
 	})
 	if err != nil {
-		log.Printf("[!] Error iterating through references: %v\n", err)
-		return
+		return nil, fmt.Errorf("error iterating through references: %w", err)
 	}
 	// Call the StartScanEngine function from the ScanEngine package
-	scan_engine.StartScanEngine(repo, plumbingRefs, configFile)
+	return scan_engine.StartScanEngine(repo, plumbingRefs, rs, scan_engine.Options{
+		Threads:    opts.Threads,
+		AllRefs:    opts.AllRefs,
+		Refs:       opts.Refs,
+		Range:      opts.Range,
+		Since:      opts.Since,
+		Until:      opts.Until,
+		MaxCommits: opts.MaxCommits,
+		Paths:      opts.Paths,
+		Ignore:     ignore,
+	})
 }
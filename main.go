@@ -1,13 +1,34 @@
 package main
 
 import (
+	"docser/internal/report"
 	"docser/internal/scanner"
 	"docser/internal/upgrade"
 	"flag"
 	"fmt"
+	"log"
 	"os"
+	"runtime"
+	"strings"
+	"time"
 )
 
+// stringList is a flag that can be repeated or given a comma-separated list
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
 const (
 	owner          = "thecyberworld"
 	repo           = "docser"
@@ -15,9 +36,25 @@ const (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "protect":
+			runProtect(os.Args[2:])
+			return
+		case "scan":
+			runScan(os.Args[2:])
+			return
+		case "baseline":
+			runBaseline(os.Args[2:])
+			return
+		}
+	}
 
-	pRepoLocation := flag.String("d", "", "Directory to be scanned. (Default is current directory)")
-	pConfigFile := flag.String("c", "", "Docser config file (Must end in .toml)")
+	options := scanFlags(flag.CommandLine)
+	pFormat := flag.String("format", "text", "Report format ("+strings.Join(report.Formats(), ", ")+")")
+	pOutput := flag.String("o", "", "Write the report to this file instead of stdout")
+	pShowSuppressed := flag.Bool("show-suppressed", false, "Report the findings suppressed by docser:allow comments separately")
+	pBaseline := flag.String("baseline", "", "Only report the findings that are not in this baseline file")
 	pUpgrade := flag.Bool("upgrade", false, "Upgrade Docser to latest version")
 	showHelp := flag.Bool("h", false, "Displays help menu")
 
@@ -33,22 +70,241 @@ func main() {
 		return
 	}
 
+	if !report.IsSupported(*pFormat) {
+		log.Fatalf("[!] Unsupported report format %q, expected one of: %s\n", *pFormat, strings.Join(report.Formats(), ", "))
+	}
+
+	opts := options()
+	opts.Format = *pFormat
+	opts.Output = *pOutput
+	opts.ShowSuppressed = *pShowSuppressed
+	opts.Baseline = *pBaseline
+
+	printBanner()
+	if _, err := scanner.ParseConfigAndInitiateScan(opts); err != nil {
+		log.Fatalf("[!] %v\n", err)
+	}
+}
+
+// scanFlags registers the flags selecting what a repository or directory scan
+// covers, and returns the function building the scan options once they are parsed
+func scanFlags(flags *flag.FlagSet) func() scanner.Options {
+	pRepoLocation := flags.String("d", "", "Directory to be scanned. (Default is current directory)")
+	pConfigFile := flags.String("c", "", "Docser config file (Must end in .toml)")
+	pThreads := flags.Int("threads", runtime.NumCPU(), "Number of workers scanning files concurrently")
+	pAllRefs := flags.Bool("all-refs", false, "Scan the history of every branch, remote-tracking branch, tag and other ref")
+	var refs stringList
+	flags.Var(&refs, "ref", "Scan the history of the references matching this name or glob (repeatable)")
+	pRange := flags.String("range", "", "Only scan the commits of a base..head range")
+	pSince := flags.String("since", "", "Only scan commits made after this date (YYYY-MM-DD or RFC3339)")
+	pUntil := flags.String("until", "", "Only scan commits made before this date (YYYY-MM-DD or RFC3339)")
+	pMaxCommits := flags.Int("max-commits", 0, "Stop after scanning this many commits (0 means no limit)")
+	var paths stringList
+	flags.Var(&paths, "path", "Only scan commits and files under this path or matching this glob (repeatable)")
+	pIgnoreFile := flags.String("ignore-file", "", "Skip the files matching the gitignore patterns of this file, on top of the .docserignore")
+	pNoGit := flags.Bool("no-git", false, "Scan the files of the directory without reading git history")
+	pRepoURL := flags.String("repo-url", "", "Clone and scan the remote repository at this URL")
+	pCloneDepth := flags.Int("clone-depth", 0, "Only clone this many commits of the remote repository (0 clones everything)")
+	pBranch := flags.String("branch", "", "Branch of the remote repository to clone (Default is the remote HEAD)")
+	pSingleBranch := flags.Bool("single-branch", false, "Only clone one branch of the remote repository")
+	pCloneToDisk := flags.Bool("clone-to-disk", false, "Clone the remote repository into a temporary directory instead of memory")
+	pGitUser := flags.String("git-user", "", "Username for HTTP auth, the password or token is read from DOCSER_GIT_PASSWORD")
+	pSSHKey := flags.String("ssh-key", "", "Private key for SSH auth, its passphrase is read from DOCSER_SSH_KEY_PASSPHRASE")
+
+	return func() scanner.Options {
+		since, err := parseDate(*pSince, false)
+		if err != nil {
+			log.Fatalf("[!] Invalid -since date: %v\n", err)
+		}
+		until, err := parseDate(*pUntil, true)
+		if err != nil {
+			log.Fatalf("[!] Invalid -until date: %v\n", err)
+		}
+
+		return scanner.Options{
+			RepositoryPath: *pRepoLocation,
+			ConfigFile:     *pConfigFile,
+			Version:        currentVersion,
+			Threads:        *pThreads,
+			AllRefs:        *pAllRefs,
+			Refs:           refs,
+			Range:          *pRange,
+			Since:          since,
+			Until:          until,
+			MaxCommits:     *pMaxCommits,
+			Paths:          paths,
+			IgnoreFile:     *pIgnoreFile,
+			NoGit:          *pNoGit,
+			RepoURL:        *pRepoURL,
+			Clone: scanner.CloneOptions{
+				Depth:            *pCloneDepth,
+				Branch:           *pBranch,
+				SingleBranch:     *pSingleBranch,
+				ToDisk:           *pCloneToDisk,
+				Username:         *pGitUser,
+				Password:         os.Getenv("DOCSER_GIT_PASSWORD"),
+				SSHKey:           *pSSHKey,
+				SSHKeyPassphrase: os.Getenv("DOCSER_SSH_KEY_PASSPHRASE"),
+			},
+		}
+	}
+}
+
+// runBaseline implements `docser baseline create`, which scans like docser does
+// and writes the fingerprints of the findings to a baseline file. Scans given
+// the file with -baseline then only report new findings.
+func runBaseline(args []string) {
+	if len(args) == 0 || args[0] != "create" {
+		fmt.Fprintln(os.Stderr, "Usage: docser baseline create [flags], see docser baseline create -h")
+		os.Exit(2)
+	}
+
+	baseline := flag.NewFlagSet("baseline create", flag.ExitOnError)
+	options := scanFlags(baseline)
+	pOutput := baseline.String("o", ".docser-baseline.json", "Write the baseline to this file")
+	baseline.Usage = func() {
+		fmt.Fprintln(baseline.Output(), "Usage: docser baseline create -o .docser-baseline.json (Optional) [scan flags]")
+		baseline.PrintDefaults()
+	}
+	baseline.Parse(args[1:])
+
+	opts := options()
+	opts.Format = "baseline"
+	opts.Output = *pOutput
+
 	printBanner()
-	repositoryPath := *pRepoLocation
-	configFile := *pConfigFile
-	scanner.ParseConfigAndInitiateScan(configFile, repositoryPath)
+	rep, err := scanner.ParseConfigAndInitiateScan(opts)
+	if err != nil {
+		log.Fatalf("[!] %v\n", err)
+	}
+	if rep != nil {
+		log.Printf("[+] Wrote %d findings to the baseline %s\n", len(rep.Findings), *pOutput)
+	}
+}
+
+// runProtect implements `docser protect`, which scans the changes that are not
+// committed yet and exits with a non-zero code on findings, so it can be used as
+// a git pre-commit hook
+func runProtect(args []string) {
+	protect := flag.NewFlagSet("protect", flag.ExitOnError)
+	pRepoLocation := protect.String("d", "", "Repository to be scanned. (Default is current directory)")
+	pConfigFile := protect.String("c", "", "Docser config file (Must end in .toml)")
+	pFormat := protect.String("format", "text", "Report format ("+strings.Join(report.Formats(), ", ")+")")
+	pOutput := protect.String("o", "", "Write the report to this file instead of stdout")
+	pStaged := protect.Bool("staged", false, "Scan the changes staged in the index (default)")
+	pUnstaged := protect.Bool("unstaged", false, "Scan the changes in the worktree that are not staged")
+	pIgnoreFile := protect.String("ignore-file", "", "Skip the files matching the gitignore patterns of this file, on top of the .docserignore")
+	pShowSuppressed := protect.Bool("show-suppressed", false, "Report the findings suppressed by docser:allow comments separately")
+	pBaseline := protect.String("baseline", "", "Only report the findings that are not in this baseline file")
+	pExitCode := protect.Int("exit-code", 1, "Exit code used when secrets are found")
+	protect.Usage = func() {
+		fmt.Fprintln(protect.Output(), "Usage: docser protect -staged (Optional) -unstaged (Optional) -d /path/to/repository (Optional) -c /path/to/.docser.toml (Optional)")
+		protect.PrintDefaults()
+	}
+	protect.Parse(args)
+
+	if !report.IsSupported(*pFormat) {
+		log.Fatalf("[!] Unsupported report format %q, expected one of: %s\n", *pFormat, strings.Join(report.Formats(), ", "))
+	}
+
+	opts := scanner.Options{
+		RepositoryPath: *pRepoLocation,
+		ConfigFile:     *pConfigFile,
+		Format:         *pFormat,
+		Output:         *pOutput,
+		Version:        currentVersion,
+		Staged:         *pStaged,
+		Unstaged:       *pUnstaged,
+		IgnoreFile:     *pIgnoreFile,
+		ShowSuppressed: *pShowSuppressed,
+		Baseline:       *pBaseline,
+	}
+	rep, err := scanner.Protect(opts)
+	if err != nil {
+		log.Fatalf("[!] %v\n", err)
+	}
+	if len(rep.Findings) > 0 {
+		os.Exit(*pExitCode)
+	}
+}
+
+// runScan implements `docser scan`, which scans files or stdin ("-") instead of
+// a repository so docser can be used in shell pipelines
+func runScan(args []string) {
+	scan := flag.NewFlagSet("scan", flag.ExitOnError)
+	pConfigFile := scan.String("c", "", "Docser config file (Must end in .toml)")
+	pFormat := scan.String("format", "text", "Report format ("+strings.Join(report.Formats(), ", ")+")")
+	pOutput := scan.String("o", "", "Write the report to this file instead of stdout")
+	pShowSuppressed := scan.Bool("show-suppressed", false, "Report the findings suppressed by docser:allow comments separately")
+	pBaseline := scan.String("baseline", "", "Only report the findings that are not in this baseline file")
+	pExitCode := scan.Int("exit-code", 1, "Exit code used when secrets are found")
+	pIgnoreFile := scan.String("ignore-file", "", "Skip the files of scanned directories matching the gitignore patterns of this file, on top of their .docserignore")
+	scan.Usage = func() {
+		fmt.Fprintln(scan.Output(), "Usage: docser scan [flags] file.md ... | -")
+		scan.PrintDefaults()
+	}
+	scan.Parse(args)
+
+	if scan.NArg() == 0 {
+		scan.Usage()
+		os.Exit(2)
+	}
+	if !report.IsSupported(*pFormat) {
+		log.Fatalf("[!] Unsupported report format %q, expected one of: %s\n", *pFormat, strings.Join(report.Formats(), ", "))
+	}
+
+	opts := scanner.Options{
+		ConfigFile:     *pConfigFile,
+		Format:         *pFormat,
+		Output:         *pOutput,
+		Version:        currentVersion,
+		Threads:        runtime.NumCPU(),
+		ShowSuppressed: *pShowSuppressed,
+		Baseline:       *pBaseline,
+		IgnoreFile:     *pIgnoreFile,
+	}
+	rep, err := scanner.ScanFiles(opts, scan.Args())
+	if err != nil {
+		log.Fatalf("[!] %v\n", err)
+	}
+	if len(rep.Findings) > 0 {
+		os.Exit(*pExitCode)
+	}
+}
+
+// parseDate parses a YYYY-MM-DD or RFC3339 date. A YYYY-MM-DD date used as an
+// upper bound covers the whole day.
+func parseDate(value string, endOfDay bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if date, err := time.Parse(time.RFC3339, value); err == nil {
+		return date, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if endOfDay {
+		date = date.Add(24*time.Hour - time.Nanosecond)
+	}
+	return date, nil
 }
 
 func showHelpMenu() {
-	fmt.Println("Usage: docser -d /path/to/directory -c /path/to/.docser.toml (Optional) -upgrade (Optional) -h (Optional)")
+	fmt.Println("Usage: docser -d /path/to/directory -c /path/to/.docser.toml (Optional) -format json|sarif|gitleaks -o report.json (Optional) -threads 4 (Optional) -all-refs | -ref main -ref 'release/*' (Optional) -range base..head -since 2023-01-01 -until 2023-12-31 -max-commits 100 -path docs/ (Optional) -ignore-file .docserignore (Optional) -no-git (Optional) -show-suppressed (Optional) -baseline .docser-baseline.json (Optional) -repo-url https://host/repo.git -clone-depth 50 -single-branch -branch main (Optional) -upgrade (Optional) -h (Optional)")
+	fmt.Println("       docser protect -staged -unstaged (Optional), see docser protect -h")
+	fmt.Println("       docser scan file.md ... | -, see docser scan -h")
+	fmt.Println("       docser baseline create -o .docser-baseline.json (Optional), see docser baseline create -h")
 	flag.PrintDefaults()
 }
 
+// printBanner writes the banner to stderr so it never ends up in a report written to stdout
 func printBanner() {
-	fmt.Println("")
+	fmt.Fprintln(os.Stderr, "")
 	banner := "o-o                        \n|  \\                       \n|   O o-o  o-o o-o o-o o-o \n|  /  | | |     \\  |-' |   \no-o   o-o  o-o o-o o-o o   \n                           \n                           "
-	fmt.Println(banner)
-	fmt.Println("by 0xFTW")
-	fmt.Println("")
-	fmt.Println("")
+	fmt.Fprintln(os.Stderr, banner)
+	fmt.Fprintln(os.Stderr, "by 0xFTW")
+	fmt.Fprintln(os.Stderr, "")
+	fmt.Fprintln(os.Stderr, "")
 }